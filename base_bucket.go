@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/kohkimakimoto/bucketstore/v/bolt"
+	"reflect"
 	"strings"
 )
 
@@ -13,6 +14,13 @@ type BaseBucket struct {
 	tx    *Tx
 	data  *bolt.Bucket
 	index *bolt.Bucket
+
+	// indexConfig is the index configuration loaded lazily.
+	indexConfig *IndexConfig
+	// schema is the schema loaded lazily.
+	schema *Schema
+	// valueMode is the value mode loaded lazily.
+	valueMode ValueMode
 }
 
 func newBaseBucket(name []byte, tx *Tx, data *bolt.Bucket, index *bolt.Bucket) *BaseBucket {
@@ -28,47 +36,191 @@ func (b *BaseBucket) Cursor() *bolt.Cursor {
 	return b.data.Cursor()
 }
 
+// Get gets the value of the item. It returns nil if the item doesn't exist or has been expired.
 func (b *BaseBucket) Get(key []byte) []byte {
-	return b.data.Get(key)
+	v := b.data.Get(key)
+	if v == nil || b.isExpired(key, timeNow()) {
+		return nil
+	}
+
+	return v
 }
 
+// Put puts the item and increments its revision. It removes the expiry of the item.
+// It runs the put hooks of the bucket in the transaction.
 func (b *BaseBucket) Put(key []byte, value []byte) error {
+	// check constraints before modifying anything,
+	// so that the failed put doesn't leave any changes in the transaction.
+	stored, jsonMap, err := b.checkValue(key, value)
+	if err != nil {
+		return err
+	}
+
+	// the hooks see the expired item as absent.
+	if err := b.deleteIfExpired(key); err != nil {
+		return err
+	}
+
+	hooks := b.hooks()
+	if err := b.runHooks(hooks.beforePut, key, value); err != nil {
+		return err
+	}
+
+	// copy the old value for the change log because it is only valid until the bucket is modified.
+	var before []byte
+	if v := b.data.Get(key); v != nil && b.tx.changeLogEnabled() {
+		before = append([]byte{}, v...)
+	}
+
+	if err := b.putValue(key, stored, jsonMap); err != nil {
+		return err
+	}
+
+	if err := b.incrementRevision(key); err != nil {
+		return err
+	}
+
+	if err := b.clearExpiry(key); err != nil {
+		return err
+	}
+
+	if err := b.appendItemChange(ChangeTypePut, key, before, b.data.Get(key)); err != nil {
+		return err
+	}
+
+	return b.runHooks(hooks.afterPut, key, b.data.Get(key))
+}
+
+// checkValue decodes the value by the value mode and checks the constraints of it.
+// It returns the bytes to store and the decoded JSON object in the json-object mode.
+func (b *BaseBucket) checkValue(key []byte, value []byte) ([]byte, map[string]interface{}, error) {
+	switch b.ValueMode() {
+	case ValueModeRaw:
+		// the raw mode doesn't validate the value. SetSchema and SetValueMode reject a schema in the raw mode.
+		return value, nil, nil
+	case ValueModeJSONAny:
+		return b.checkJSONAny(key, value)
+	}
+
 	var jsonMap map[string]interface{}
-	if err := json.Unmarshal(value, &jsonMap); err != nil {
-		return fmt.Errorf("invalid json formatted data: %v", err)
+	if err := decodeJSON(value, &jsonMap); err != nil {
+		return nil, nil, fmt.Errorf("invalid json formatted data: %v", err)
 	}
 
-	reformattedJsonBytes, err := json.Marshal(jsonMap)
+	value, err := b.formatJSON(value, jsonMap)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	if err := b.validateSchema(key, jsonMap); err != nil {
+		return nil, nil, err
 	}
 
-	value = reformattedJsonBytes
+	if err := b.checkUnique(key, jsonMap); err != nil {
+		return nil, nil, err
+	}
 
-	err = b.refreshIndex(key, jsonMap)
+	return value, jsonMap, nil
+}
+
+// checkJSONAny checks any JSON value that is saved without indexing it.
+func (b *BaseBucket) checkJSONAny(key []byte, value []byte) ([]byte, map[string]interface{}, error) {
+	var v interface{}
+	if err := decodeJSON(value, &v); err != nil {
+		return nil, nil, fmt.Errorf("invalid json formatted data: %v", err)
+	}
+
+	value, err := b.formatJSON(value, v)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	if err := b.validateSchema(key, v); err != nil {
+		return nil, nil, err
+	}
+
+	return value, nil, nil
+}
+
+// putValue saves the value checked by checkValue with the indexes in the json-object mode.
+func (b *BaseBucket) putValue(key []byte, value []byte, jsonMap map[string]interface{}) error {
+	if b.ValueMode() == ValueModeJSONObject {
+		if err := b.refreshIndex(key, jsonMap); err != nil {
+			return err
+		}
 	}
 
 	// save key/value pair
-	if err := b.data.Put(key, value); err != nil {
-		return err
+	return b.data.Put(key, value)
+}
+
+// formatJSON gets the bytes to store from the original JSON bytes and the decoded value.
+// Numbers are decoded to json.Number, so that reformatting doesn't lose their precision.
+func (b *BaseBucket) formatJSON(value []byte, v interface{}) ([]byte, error) {
+	// the transaction of the migration doesn't have the database.
+	if b.tx.db != nil && b.tx.db.options.PreserveJSON {
+		return value, nil
 	}
 
-	return nil
+	return json.Marshal(v)
 }
 
+// Delete deletes the item. It runs the delete hooks of the bucket in the transaction if the item exists.
+// The expired item is deleted as expired without the hooks.
 func (b *BaseBucket) Delete(key []byte) error {
-	if err := b.refreshIndex(key, nil); err != nil {
+	if b.isExpired(key, timeNow()) {
+		return b.expire(key)
+	}
+
+	hooks := b.hooks()
+
+	exists := b.data.Get(key) != nil
+	if exists {
+		if err := b.runHooks(hooks.beforeDelete, key, b.data.Get(key)); err != nil {
+			return err
+		}
+	}
+
+	// copy the old value for the change log and the hooks because it is only valid until the bucket is modified.
+	var before []byte
+	if exists && (b.tx.changeLogEnabled() || len(hooks.afterDelete) > 0) {
+		before = append([]byte{}, b.data.Get(key)...)
+	}
+
+	if err := b.deleteItem(key); err != nil {
 		return err
 	}
 
+	if !exists {
+		// nothing is deleted.
+		return nil
+	}
+
+	if err := b.appendItemChange(ChangeTypeDelete, key, before, nil); err != nil {
+		return err
+	}
+
+	return b.runHooks(hooks.afterDelete, key, before)
+}
+
+// deleteItem deletes the item with the indexes, the revision and the expiry of it.
+func (b *BaseBucket) deleteItem(key []byte) error {
+	if b.ValueMode() == ValueModeJSONObject {
+		if err := b.refreshIndex(key, nil); err != nil {
+			return err
+		}
+	}
+
 	// delete key/value pair
 	if err := b.data.Delete(key); err != nil {
 		return err
 	}
 
-	return nil
+	if err := b.deleteRevision(key); err != nil {
+		return err
+	}
+
+	return b.clearExpiry(key)
 }
 
 func (b *BaseBucket) NextSequence() (uint64, error) {
@@ -94,6 +246,11 @@ func (b *BaseBucket) IndexCursor(propName string) *IndexCursor {
 func (b *BaseBucket) IndexProperties() (props []string, err error) {
 	// iterate indexed properties for system inspection.
 	err = b.index.ForEach(func(k, v []byte) error {
+		if isCompoundIndexName(string(k)) || isTextIndexName(string(k)) {
+			// compound and text indexes are not properties.
+			return nil
+		}
+
 		props = append(props, string(k))
 		return nil
 	})
@@ -107,57 +264,72 @@ func (b *BaseBucket) IndexProperties() (props []string, err error) {
 func (b *BaseBucket) refreshIndex(key []byte, jsonMap map[string]interface{}) error {
 	deletedIndexBucketNames := []string{}
 
+	config, err := b.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	var props map[string][]interface{}
+	if jsonMap != nil {
+		props = flattenProperties(jsonMap)
+	}
+
+	// unchanged properties keep their index as it is.
+	unchanged := map[string]bool{}
+
 	// Delete existing index
+	var oldJsonMap map[string]interface{}
 	oldValue := b.data.Get(key)
 	if oldValue != nil {
 		// Try to unmarshal value as a json to index by it's properties.
 		// If it is not a json or is an array of json. doesn't index it.
-		var oldJsonMap map[string]interface{}
-		if err := json.Unmarshal(oldValue, &oldJsonMap); err == nil {
+		if err := decodeJSON(oldValue, &oldJsonMap); err == nil {
 			// exists indexes
 			// remove them.
-			for n, v := range oldJsonMap {
-				indexKey := genIndexKey(v, key)
-				if indexKey == nil {
+			for n, values := range flattenProperties(oldJsonMap) {
+				if newValues, ok := props[n]; ok && reflect.DeepEqual(values, newValues) {
+					unchanged[n] = true
 					continue
 				}
 
 				indexBucket := b.getIndexBucket(n)
-				if indexBucket != nil {
+				if indexBucket == nil {
+					continue
+				}
+
+				for _, v := range values {
+					indexKey := genIndexKey(config.indexValue(n, v), key)
+					if indexKey == nil {
+						continue
+					}
+
 					err := indexBucket.Delete(indexKey)
 					if err != nil {
 						return err
 					}
-
-					deletedIndexBucketNames = append(deletedIndexBucketNames, n)
 				}
+
+				deletedIndexBucketNames = append(deletedIndexBucketNames, n)
 			}
 		}
 	}
 
 	// create new index
 	if jsonMap != nil {
-		for n, v := range jsonMap {
-			if b.isIgnorePattern(n) {
-				continue
-			}
-
-			indexKey := genIndexKey(v, key)
-			if indexKey == nil {
-				continue
-			}
-
-			indexBucket, err := b.createIndexBucketIfNotExists(n)
-			if err != nil {
-				return err
-			}
+		err := b.putIndex(key, jsonMap, func(n string) bool {
+			return !unchanged[n]
+		})
+		if err != nil {
+			return err
+		}
+	}
 
-			err = indexBucket.Put(indexKey, key)
+	if err := b.refreshCompoundIndex(key, oldJsonMap, jsonMap); err != nil {
+		return err
+	}
 
-			if err != nil {
-				return err
-			}
-		}
+	if err := b.refreshTextIndex(key, oldJsonMap, jsonMap); err != nil {
+		return err
 	}
 
 	// clean empty buckets
@@ -177,7 +349,74 @@ func (b *BaseBucket) refreshIndex(key []byte, jsonMap map[string]interface{}) er
 	return nil
 }
 
-func (b *BaseBucket) isIgnorePattern(propName string) bool {
+// putIndex creates the index of the properties indexed by the index configuration.
+// If the match function is not nil, it creates only the index of the properties matching it.
+func (b *BaseBucket) putIndex(key []byte, jsonMap map[string]interface{}, match func(propName string) bool) error {
+	config, err := b.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	for n, values := range flattenProperties(jsonMap) {
+		if !config.IsIndexed(n) {
+			continue
+		}
+
+		if match != nil && !match(n) {
+			continue
+		}
+
+		indexKeys, entryValues := genIndexEntries(config, n, values, key)
+		for i, indexKey := range indexKeys {
+			indexBucket, err := b.createIndexBucketIfNotExists(n)
+			if err != nil {
+				return err
+			}
+
+			if err := indexBucket.Put(indexKey, entryValues[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// flattenProperties flattens nested JSON objects to a map that has dotted property paths as keys.
+// For instance, {"address": {"city": "Tokyo"}} is flattened to {"address.city": ["Tokyo"]}.
+// Each scalar element of an array becomes one of the values of the property.
+// For instance, {"tags": ["go", "db"]} is flattened to {"tags": ["go", "db"]}.
+// The properties matching the ignore pattern are not included.
+func flattenProperties(jsonMap map[string]interface{}) map[string][]interface{} {
+	props := map[string][]interface{}{}
+	flattenPropertiesWithPrefix(props, "", jsonMap)
+	return props
+}
+
+func flattenPropertiesWithPrefix(props map[string][]interface{}, prefix string, jsonMap map[string]interface{}) {
+	for n, v := range jsonMap {
+		if isIgnorePattern(n) {
+			continue
+		}
+
+		flattenValue(props, prefix+n, v)
+	}
+}
+
+func flattenValue(props map[string][]interface{}, path string, value interface{}) {
+	switch converted := value.(type) {
+	case map[string]interface{}:
+		flattenPropertiesWithPrefix(props, path+".", converted)
+	case []interface{}:
+		for _, v := range converted {
+			flattenValue(props, path, v)
+		}
+	default:
+		props[path] = append(props[path], value)
+	}
+}
+
+func isIgnorePattern(propName string) bool {
 	return strings.HasPrefix(propName, "_")
 }
 
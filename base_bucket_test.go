@@ -61,3 +61,67 @@ func TestBaseBucketIndexProperties(t *testing.T) {
 		return nil
 	})
 }
+
+func TestBaseBucketNestedIndexProperties(t *testing.T) {
+	// setup database
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	ds, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer ds.Close()
+
+	ds.Update(func(tx *Tx) error {
+		b, err := tx.createBaseBucketIfNotExists([]byte("test_bucket1"))
+		if err != nil {
+			t.Errorf("should not raise error: %v", err)
+		}
+
+		key := []byte("key1")
+		value := []byte(`{"name": "kohki", "address": {"city": "Tokyo", "geo": {"lat": 35.6}, "_memo": "x"}}`)
+		err = b.Put(key, value)
+		if err != nil {
+			t.Errorf("should not raise error: %v", err)
+		}
+
+		props, _ := b.IndexProperties()
+		expected := []string{"address.city", "address.geo.lat", "name"}
+		if len(props) != len(expected) {
+			t.Fatalf("invalid props: %v", props)
+		}
+		for i, p := range props {
+			if p != expected[i] {
+				t.Errorf("invalid prop: %s", p)
+			}
+		}
+
+		// update removes stale nested index.
+		value = []byte(`{"name": "kohki", "address": {"city": "Osaka"}}`)
+		err = b.Put(key, value)
+		if err != nil {
+			t.Errorf("should not raise error: %v", err)
+		}
+
+		if b.getIndexBucket("address.geo.lat") != nil {
+			t.Errorf("stale index bucket should be deleted")
+		}
+
+		if idx := b.IndexCursor("address.city").Get("Tokyo"); idx != nil {
+			t.Errorf("stale index should be deleted")
+		}
+
+		if idx := b.IndexCursor("address.city").Get("Osaka"); idx == nil {
+			t.Errorf("index should be found")
+		}
+
+		return nil
+	})
+}
@@ -1,5 +1,10 @@
 package bucketstore
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type Bucket struct {
 	name      string
 	datastore *DB
@@ -15,17 +20,26 @@ func newBucket(name string, ds *DB, baseBucket *BaseBucket) *Bucket {
 	}
 }
 
-func (bucket *Bucket) Get(key []byte) (*Item, error) {
-	v, err := bucket.GetRaw(key)
-	if err != nil {
-		return nil, err
+func (bucket *Bucket) Get(key []byte) (item *Item, err error) {
+	if bucket.baseBucket != nil {
+		return bucket.baseBucket.getItem(key), nil
 	}
 
-	if v == nil {
-		return nil, nil
-	}
+	err = bucket.datastore.View(func(tx *Tx) error {
+		baseBucket, err := tx.baseBucket([]byte(bucket.name))
+		if err != nil {
+			return err
+		}
+
+		if baseBucket == nil {
+			return nil
+		}
 
-	return &Item{Key: key, Value: v}, nil
+		item = baseBucket.getItem(key)
+		return nil
+	})
+
+	return item, err
 }
 
 func (bucket *Bucket) GetRaw(key []byte) (value []byte, err error) {
@@ -53,6 +67,25 @@ func (bucket *Bucket) GetRaw(key []byte) (value []byte, err error) {
 	return value, err
 }
 
+// GetObject gets the item of the key and unmarshals it into the value pointed to by out by encoding/json.
+// It returns false if the item does not exist.
+func (bucket *Bucket) GetObject(key []byte, out interface{}) (bool, error) {
+	v, err := bucket.GetRaw(key)
+	if err != nil {
+		return false, err
+	}
+
+	if v == nil {
+		return false, nil
+	}
+
+	if err := json.Unmarshal(v, out); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
 func (bucket *Bucket) Put(item *Item) (err error) {
 	return bucket.PutRaw(item.Key, item.Value)
 }
@@ -74,6 +107,73 @@ func (bucket *Bucket) PutRaw(key []byte, value []byte) (err error) {
 	})
 }
 
+// PutWithTTL puts the item that expires after the ttl.
+// See BaseBucket.PutWithTTL.
+func (bucket *Bucket) PutWithTTL(key []byte, value []byte, ttl time.Duration) error {
+	return bucket.updateBaseBucket(func(baseBucket *BaseBucket) error {
+		return baseBucket.PutWithTTL(key, value, ttl)
+	})
+}
+
+// PutObject marshals the value by encoding/json and puts it as the item of the key.
+// The value must be marshalled to a json object, like a struct or a map.
+func (bucket *Bucket) PutObject(key []byte, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return bucket.PutRaw(key, value)
+}
+
+// Patch partially updates the item by the JSON Patch or the JSON Merge Patch in a transaction.
+// See BaseBucket.Patch.
+func (bucket *Bucket) Patch(key []byte, patch []byte) error {
+	return bucket.updateBaseBucket(func(baseBucket *BaseBucket) error {
+		return baseBucket.Patch(key, patch)
+	})
+}
+
+// PutIf puts the item only if the revision of the item is the expected revision.
+// See BaseBucket.PutIf.
+func (bucket *Bucket) PutIf(key []byte, value []byte, expectedRevision uint64) error {
+	return bucket.updateBaseBucket(func(baseBucket *BaseBucket) error {
+		return baseBucket.PutIf(key, value, expectedRevision)
+	})
+}
+
+// PutIfAbsent puts the item only if the item doesn't exist.
+// See BaseBucket.PutIfAbsent.
+func (bucket *Bucket) PutIfAbsent(key []byte, value []byte) error {
+	return bucket.updateBaseBucket(func(baseBucket *BaseBucket) error {
+		return baseBucket.PutIfAbsent(key, value)
+	})
+}
+
+// DeleteIf deletes the item only if the revision of the item is the expected revision.
+// See BaseBucket.DeleteIf.
+func (bucket *Bucket) DeleteIf(key []byte, expectedRevision uint64) error {
+	if bucket.baseBucket != nil {
+		return bucket.baseBucket.DeleteIf(key, expectedRevision)
+	}
+
+	return bucket.datastore.Update(func(tx *Tx) error {
+		baseBucket, err := tx.baseBucket([]byte(bucket.name))
+		if err != nil {
+			return err
+		}
+
+		if baseBucket == nil {
+			if expectedRevision != 0 {
+				return &ErrConflict{Key: key, Expected: expectedRevision, Actual: 0}
+			}
+			return nil
+		}
+
+		return baseBucket.DeleteIf(key, expectedRevision)
+	})
+}
+
 func (bucket *Bucket) Delete(key []byte) error {
 	if bucket.baseBucket != nil {
 		baseBucket := bucket.baseBucket
@@ -162,6 +262,200 @@ func (bucket *Bucket) NextSequenceBytes() ([]byte, error) {
 	return Uint64ToBytes(i), nil
 }
 
+// IndexConfig gets the index configuration of the bucket.
+func (bucket *Bucket) IndexConfig() (*IndexConfig, error) {
+	if bucket.baseBucket != nil {
+		return bucket.baseBucket.IndexConfig()
+	}
+
+	config := newIndexConfig()
+	err := bucket.datastore.View(func(tx *Tx) error {
+		baseBucket, err := tx.baseBucket([]byte(bucket.name))
+		if err != nil {
+			return err
+		}
+
+		if baseBucket == nil {
+			return nil
+		}
+
+		config, err = baseBucket.IndexConfig()
+		return err
+	})
+
+	return config, err
+}
+
+// SetIndexMode changes the index mode of the bucket.
+// See BaseBucket.SetIndexMode.
+func (bucket *Bucket) SetIndexMode(mode IndexMode) error {
+	return bucket.updateBaseBucket(func(baseBucket *BaseBucket) error {
+		return baseBucket.SetIndexMode(mode)
+	})
+}
+
+// AddIndex declares the property to be indexed.
+// See BaseBucket.AddIndex.
+func (bucket *Bucket) AddIndex(propName string) error {
+	return bucket.updateBaseBucket(func(baseBucket *BaseBucket) error {
+		return baseBucket.AddIndex(propName)
+	})
+}
+
+// AddUniqueIndex declares the property to be indexed with a unique constraint.
+// See BaseBucket.AddUniqueIndex.
+func (bucket *Bucket) AddUniqueIndex(propName string) error {
+	return bucket.updateBaseBucket(func(baseBucket *BaseBucket) error {
+		return baseBucket.AddUniqueIndex(propName)
+	})
+}
+
+// AddIntegerIndex declares the property to be indexed with exact 64-bit integers.
+// See BaseBucket.AddIntegerIndex.
+func (bucket *Bucket) AddIntegerIndex(propName string) error {
+	return bucket.updateBaseBucket(func(baseBucket *BaseBucket) error {
+		return baseBucket.AddIntegerIndex(propName)
+	})
+}
+
+// DropIndex removes the declaration of the property.
+// See BaseBucket.DropIndex.
+func (bucket *Bucket) DropIndex(propName string) error {
+	return bucket.updateBaseBucket(func(baseBucket *BaseBucket) error {
+		return baseBucket.DropIndex(propName)
+	})
+}
+
+// AddCompoundIndex declares the compound index over the ordered properties.
+// See BaseBucket.AddCompoundIndex.
+func (bucket *Bucket) AddCompoundIndex(propNames ...string) error {
+	return bucket.updateBaseBucket(func(baseBucket *BaseBucket) error {
+		return baseBucket.AddCompoundIndex(propNames...)
+	})
+}
+
+// DropCompoundIndex removes the declaration of the compound index.
+// See BaseBucket.DropCompoundIndex.
+func (bucket *Bucket) DropCompoundIndex(propNames ...string) error {
+	return bucket.updateBaseBucket(func(baseBucket *BaseBucket) error {
+		return baseBucket.DropCompoundIndex(propNames...)
+	})
+}
+
+// AddTextIndex declares the text index on the string property.
+// See BaseBucket.AddTextIndex.
+func (bucket *Bucket) AddTextIndex(propName string, cjkBigram bool) error {
+	return bucket.updateBaseBucket(func(baseBucket *BaseBucket) error {
+		return baseBucket.AddTextIndex(propName, cjkBigram)
+	})
+}
+
+// DropTextIndex removes the declaration of the text index.
+// See BaseBucket.DropTextIndex.
+func (bucket *Bucket) DropTextIndex(propName string) error {
+	return bucket.updateBaseBucket(func(baseBucket *BaseBucket) error {
+		return baseBucket.DropTextIndex(propName)
+	})
+}
+
+// SetCollation sets the collation of the string index of the property.
+// See BaseBucket.SetCollation.
+func (bucket *Bucket) SetCollation(propName string, collation *Collation) error {
+	return bucket.updateBaseBucket(func(baseBucket *BaseBucket) error {
+		return baseBucket.SetCollation(propName, collation)
+	})
+}
+
+// Schema gets the JSON Schema of the bucket. It returns nil if the bucket doesn't have a schema.
+func (bucket *Bucket) Schema() ([]byte, error) {
+	if bucket.baseBucket != nil {
+		return bucket.baseBucket.Schema(), nil
+	}
+
+	var schema []byte
+	err := bucket.datastore.View(func(tx *Tx) error {
+		baseBucket, err := tx.baseBucket([]byte(bucket.name))
+		if err != nil {
+			return err
+		}
+
+		if baseBucket == nil {
+			return nil
+		}
+
+		if s := baseBucket.Schema(); s != nil {
+			schema = append([]byte{}, s...)
+		}
+		return nil
+	})
+
+	return schema, err
+}
+
+// SetSchema sets the JSON Schema of the bucket.
+// See BaseBucket.SetSchema.
+func (bucket *Bucket) SetSchema(schema []byte) error {
+	return bucket.updateBaseBucket(func(baseBucket *BaseBucket) error {
+		return baseBucket.SetSchema(schema)
+	})
+}
+
+// DropSchema removes the JSON Schema of the bucket.
+func (bucket *Bucket) DropSchema() error {
+	return bucket.updateBaseBucket(func(baseBucket *BaseBucket) error {
+		return baseBucket.DropSchema()
+	})
+}
+
+// ValueMode gets the value mode of the bucket.
+func (bucket *Bucket) ValueMode() (ValueMode, error) {
+	if bucket.baseBucket != nil {
+		return bucket.baseBucket.ValueMode(), nil
+	}
+
+	mode := ValueModeJSONObject
+	err := bucket.datastore.View(func(tx *Tx) error {
+		baseBucket, err := tx.baseBucket([]byte(bucket.name))
+		if err != nil {
+			return err
+		}
+
+		if baseBucket == nil {
+			return nil
+		}
+
+		mode = baseBucket.ValueMode()
+		return nil
+	})
+
+	return mode, err
+}
+
+// SetValueMode changes the value mode of the bucket.
+// See BaseBucket.SetValueMode.
+func (bucket *Bucket) SetValueMode(mode ValueMode) error {
+	return bucket.updateBaseBucket(func(baseBucket *BaseBucket) error {
+		return baseBucket.SetValueMode(mode)
+	})
+}
+
+// updateBaseBucket runs the function with the base bucket in a writable transaction.
+// It creates the bucket if it doesn't exist.
+func (bucket *Bucket) updateBaseBucket(fn func(*BaseBucket) error) error {
+	if bucket.baseBucket != nil {
+		return fn(bucket.baseBucket)
+	}
+
+	return bucket.datastore.Update(func(tx *Tx) error {
+		baseBucket, err := tx.createBaseBucketIfNotExists([]byte(bucket.name))
+		if err != nil {
+			return err
+		}
+
+		return fn(baseBucket)
+	})
+}
+
 func (bucket *Bucket) BaseBucket() *BaseBucket {
 	return bucket.baseBucket
 }
@@ -272,3 +272,113 @@ func TestBucketRollbackWithTx(t *testing.T) {
 		t.Errorf("should be nil: %v", v)
 	}
 }
+
+type testAnimal struct {
+	Name  string   `json:"name"`
+	Class string   `json:"class"`
+	Age   int      `json:"age"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+func TestBucketObject(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	bucket := db.Bucket("zoo")
+	err = bucket.PutObject([]byte("key1"), &testAnimal{Name: "joe", Class: "lion", Age: 5, Tags: []string{"a"}})
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	bucket.PutObject([]byte("key2"), &testAnimal{Name: "coo", Class: "tiger", Age: 6})
+
+	var animal testAnimal
+	found, err := bucket.GetObject([]byte("key1"), &animal)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if !found {
+		t.Errorf("should be found")
+	}
+	if animal.Name != "joe" || animal.Class != "lion" || animal.Age != 5 || len(animal.Tags) != 1 || animal.Tags[0] != "a" {
+		t.Errorf("unmatch: %v", animal)
+	}
+
+	found, err = bucket.GetObject([]byte("key9"), &animal)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if found {
+		t.Errorf("should not be found")
+	}
+
+	// the property of the struct is indexed.
+	q := bucket.Query()
+	q.Filter = &PropValueMatchFilter{Property: "class", Match: "tiger"}
+	var animals []testAnimal
+	if err := q.Decode(&animals); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if len(animals) != 1 || animals[0].Name != "coo" {
+		t.Errorf("unmatch: %v", animals)
+	}
+
+	// values that are not objects can't be put.
+	if err := bucket.PutObject([]byte("key3"), "foo"); err == nil {
+		t.Errorf("should raise error")
+	}
+
+	// in a transaction
+	err = db.Update(func(tx *Tx) error {
+		bucket, err := tx.Bucket("zoo")
+		if err != nil {
+			return err
+		}
+
+		if err := bucket.PutObject([]byte("key3"), &testAnimal{Name: "tony", Class: "horse", Age: 2}); err != nil {
+			return err
+		}
+
+		var animal testAnimal
+		found, err := bucket.GetObject([]byte("key3"), &animal)
+		if err != nil {
+			return err
+		}
+		if !found || animal.Name != "tony" {
+			t.Errorf("unmatch: %v", animal)
+		}
+
+		var animals []*testAnimal
+		if err := bucket.Query().Decode(&animals); err != nil {
+			return err
+		}
+		if len(animals) != 3 || animals[2].Name != "tony" {
+			t.Errorf("unmatch: %v", animals)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	// no items
+	animals = nil
+	if err := db.Bucket("empty").Query().Decode(&animals); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if len(animals) != 0 {
+		t.Errorf("should be empty: %v", animals)
+	}
+}
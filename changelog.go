@@ -0,0 +1,339 @@
+package bucketstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+//
+// # Change log specification.
+//
+// The change log is an append-only log of the writes of all buckets
+// stored in the changes bucket of the system area.
+// It is written in the same transaction as the writes.
+//
+//   <sequence:8 bytes> : <json encoded ChangeEvent>
+//
+// The sequence is the sequence of the changes bucket.
+// The old events are deleted by the retention when a new event is appended.
+//
+
+// ChangeType is a type of change events.
+type ChangeType string
+
+const (
+	// ChangeTypePut is a change to put an item.
+	ChangeTypePut ChangeType = "put"
+	// ChangeTypeDelete is a change to delete an item.
+	ChangeTypeDelete ChangeType = "delete"
+	// ChangeTypeExpire is a change to delete an expired item by the next write of the key or the reaper.
+	ChangeTypeExpire ChangeType = "expire"
+	// ChangeTypeDrop is a change to delete a bucket.
+	ChangeTypeDrop ChangeType = "drop"
+)
+
+// ChangeEvent is an event of the change log.
+type ChangeEvent struct {
+	Sequence uint64     `json:"sequence"`
+	Type     ChangeType `json:"type"`
+	Bucket   string     `json:"bucket"`
+	// Key is the key of the item. It is nil for ChangeTypeDrop.
+	Key []byte `json:"key,omitempty"`
+	// Before is the value before the change. It is nil if the item didn't exist.
+	Before []byte `json:"before,omitempty"`
+	// After is the value after the change. It is nil if the item was deleted.
+	After []byte    `json:"after,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// ErrChangeLogTruncated is returned when watching from the sequence whose events have been deleted by the retention,
+// or when the watcher falls behind the retention.
+type ErrChangeLogTruncated struct {
+	// Sequence is the requested sequence.
+	Sequence uint64
+	// FirstSequence is the sequence of the oldest event in the change log.
+	FirstSequence uint64
+}
+
+func (e *ErrChangeLogTruncated) Error() string {
+	return fmt.Sprintf("the change log after the sequence %d has been truncated. the oldest event is %d", e.Sequence, e.FirstSequence)
+}
+
+// changeLogEnabled checks whether the change log is written in the transaction.
+func (tx *Tx) changeLogEnabled() bool {
+	// the transaction of the migration doesn't have the database.
+	return tx.db != nil && tx.db.options.ChangeLog
+}
+
+// appendChange appends the event to the change log and notifies the watchers after committing.
+func (tx *Tx) appendChange(event *ChangeEvent) error {
+	if !tx.changeLogEnabled() {
+		return nil
+	}
+
+	changes := tx.bChanges()
+
+	seq, err := changes.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	event.Sequence = seq
+	event.Time = timeNow()
+
+	v, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if err := changes.Put(Uint64ToBytes(seq), v); err != nil {
+		return err
+	}
+
+	if retention := tx.db.options.ChangeLogRetention; retention > 0 && seq > retention {
+		// collect the keys at first because the bucket must not be modified while iterating.
+		keys := [][]byte{}
+		end := seq - retention
+		c := changes.Cursor()
+		for k, _ := c.First(); k != nil && BytesToUint64(k) <= end; k, _ = c.Next() {
+			keys = append(keys, append([]byte{}, k...))
+		}
+
+		for _, k := range keys {
+			if err := changes.Delete(k); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !tx.changed {
+		tx.changed = true
+		tx.internalTx.OnCommit(tx.db.notifyChanges)
+	}
+
+	return nil
+}
+
+// appendItemChange appends the event of the item to the change log.
+func (b *BaseBucket) appendItemChange(changeType ChangeType, key []byte, before []byte, after []byte) error {
+	return b.tx.appendChange(&ChangeEvent{
+		Type:   changeType,
+		Bucket: string(b.name),
+		Key:    key,
+		Before: before,
+		After:  after,
+	})
+}
+
+// changeSignal gets the channel that is closed when the next changes are committed.
+func (db *DB) changeSignal() <-chan struct{} {
+	db.changeMutex.Lock()
+	defer db.changeMutex.Unlock()
+
+	if db.changeNotify == nil {
+		db.changeNotify = make(chan struct{})
+	}
+
+	return db.changeNotify
+}
+
+func (db *DB) notifyChanges() {
+	db.changeMutex.Lock()
+	defer db.changeMutex.Unlock()
+
+	if db.changeNotify != nil {
+		close(db.changeNotify)
+		db.changeNotify = nil
+	}
+}
+
+// ChangeSequence gets the sequence of the latest event in the change log.
+// Watch from it to get only the events after now.
+func (db *DB) ChangeSequence() (seq uint64, err error) {
+	err = db.View(func(tx *Tx) error {
+		changes := tx.bChanges()
+		if changes == nil {
+			return nil
+		}
+
+		// the retention keeps the latest event at least.
+		if k, _ := changes.Cursor().Last(); k != nil {
+			seq = BytesToUint64(k)
+		}
+		return nil
+	})
+
+	return seq, err
+}
+
+// Watch watches the change events of the bucket after the sequence.
+// If the bucket is empty, it watches the events of all buckets.
+// It requires the ChangeLog option.
+//
+//	w := db.Watch("zoo", seq)
+//	defer w.Close()
+//	for w.Next() {
+//	    event := w.Event()
+//	}
+//	if err := w.Err(); err != nil {
+//	    ...
+//	}
+func (db *DB) Watch(bucket string, fromSequence uint64) *Watcher {
+	w := &Watcher{
+		db:     db,
+		bucket: bucket,
+		events: make(chan *ChangeEvent),
+		done:   make(chan struct{}),
+		errc:   make(chan error, 1),
+	}
+
+	go func() {
+		err := w.run(fromSequence)
+		if err == errStopIteration {
+			err = nil
+		}
+
+		w.errc <- err
+		close(w.events)
+	}()
+
+	return w
+}
+
+// watchBatchSize is the max number of events that a watcher reads in a read-only transaction.
+const watchBatchSize = 100
+
+// Watcher walks change events one by one. It waits for the next event until it is closed.
+// The events are read in read-only transactions that are closed while waiting.
+type Watcher struct {
+	db        *DB
+	bucket    string
+	events    chan *ChangeEvent
+	done      chan struct{}
+	errc      chan error
+	event     *ChangeEvent
+	err       error
+	finished  bool
+	closeOnce sync.Once
+}
+
+func (w *Watcher) run(fromSequence uint64) error {
+	if !w.db.options.ChangeLog {
+		return fmt.Errorf("the change log is disabled. set the ChangeLog option to watch changes.")
+	}
+
+	seq := fromSequence
+	for {
+		// gets the signal before reading not to miss the changes committed while reading.
+		signal := w.db.changeSignal()
+
+		events := []*ChangeEvent{}
+		err := w.db.View(func(tx *Tx) error {
+			changes := tx.bChanges()
+			if changes == nil {
+				return nil
+			}
+
+			c := changes.Cursor()
+
+			// the sequences are contiguous, so a gap means the events have been deleted by the retention
+			// while the watcher is behind.
+			k, v := c.Seek(Uint64ToBytes(seq + 1))
+			if k != nil && BytesToUint64(k) != seq+1 {
+				first, _ := c.First()
+				return &ErrChangeLogTruncated{Sequence: seq, FirstSequence: BytesToUint64(first)}
+			}
+
+			for ; k != nil && len(events) < watchBatchSize; k, v = c.Next() {
+				event := &ChangeEvent{}
+				if err := json.Unmarshal(v, event); err != nil {
+					return err
+				}
+
+				events = append(events, event)
+			}
+
+			return nil
+		})
+		if err != nil {
+			select {
+			case <-w.db.closed:
+				// the database has been closed while reading.
+				return ErrDatabaseClosed
+			default:
+				return err
+			}
+		}
+
+		for _, event := range events {
+			seq = event.Sequence
+			if w.bucket != "" && event.Bucket != w.bucket {
+				continue
+			}
+
+			select {
+			case w.events <- event:
+			case <-w.done:
+				return errStopIteration
+			case <-w.db.closed:
+				return ErrDatabaseClosed
+			}
+		}
+
+		if len(events) > 0 {
+			continue
+		}
+
+		select {
+		case <-signal:
+		case <-w.done:
+			return errStopIteration
+		case <-w.db.closed:
+			return ErrDatabaseClosed
+		}
+	}
+}
+
+// Next moves the watcher to the next event. It blocks until the next event is committed.
+// It returns false when the watcher or the database is closed, or an error occurred.
+// After the database is closed, Err returns ErrDatabaseClosed.
+func (w *Watcher) Next() bool {
+	if w.finished {
+		return false
+	}
+
+	event, ok := <-w.events
+	if !ok {
+		w.finish()
+		return false
+	}
+
+	w.event = event
+	return true
+}
+
+// Event returns the current event.
+func (w *Watcher) Event() *ChangeEvent {
+	return w.event
+}
+
+// Err returns the error occurred while watching.
+func (w *Watcher) Err() error {
+	return w.err
+}
+
+// Close stops watching. It can be called from another goroutine to unblock Next.
+func (w *Watcher) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
+
+	return nil
+}
+
+func (w *Watcher) finish() {
+	w.finished = true
+	w.err = <-w.errc
+}
@@ -0,0 +1,246 @@
+package bucketstore
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	options := NewOptions()
+	options.ChangeLog = true
+
+	db, err := Open(tmpFile.Name(), 0600, options)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	zoo := db.Bucket("zoo")
+	zoo.PutRaw([]byte("key1"), []byte(`{"name": "joe"}`))
+	db.Bucket("farm").PutRaw([]byte("key1"), []byte(`{"name": "foo"}`))
+	zoo.PutRaw([]byte("key1"), []byte(`{"name": "coo"}`))
+
+	// a failed write isn't logged.
+	zoo.PutRaw([]byte("key2"), []byte(`[]`))
+
+	seq, err := db.ChangeSequence()
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if seq != 3 {
+		t.Errorf("should be 3: %d", seq)
+	}
+
+	w := db.Watch("zoo", 0)
+	defer w.Close()
+
+	expected := []struct {
+		changeType ChangeType
+		before     string
+		after      string
+	}{
+		{ChangeTypePut, "", `{"name":"joe"}`},
+		{ChangeTypePut, `{"name":"joe"}`, `{"name":"coo"}`},
+		{ChangeTypeDelete, `{"name":"coo"}`, ""},
+		{ChangeTypeDrop, "", ""},
+	}
+
+	go func() {
+		zoo.Delete([]byte("key1"))
+		// deleting a missing item isn't logged.
+		zoo.Delete([]byte("key1"))
+		db.DeleteBucket("zoo")
+	}()
+
+	for i, e := range expected {
+		if !w.Next() {
+			t.Fatalf("should get the event %d: %v", i, w.Err())
+		}
+
+		event := w.Event()
+		if event.Type != e.changeType || string(event.Before) != e.before || string(event.After) != e.after || event.Bucket != "zoo" {
+			t.Errorf("unmatch event %d: %v", i, event)
+		}
+	}
+
+	if w.Event().Sequence != 5 {
+		t.Errorf("should be 5: %d", w.Event().Sequence)
+	}
+
+	// close unblocks Next.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		w.Close()
+	}()
+
+	if w.Next() {
+		t.Errorf("should not get any events: %v", w.Event())
+	}
+	if err := w.Err(); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	// all buckets from the sequence.
+	w2 := db.Watch("", 3)
+	defer w2.Close()
+
+	if !w2.Next() || w2.Event().Sequence != 4 || w2.Event().Type != ChangeTypeDelete {
+		t.Errorf("unmatch: %v", w2.Event())
+	}
+
+	// the events are read in some transactions.
+	farm := db.Bucket("farm")
+	for i := 0; i < watchBatchSize*2+1; i++ {
+		farm.PutRaw([]byte("key1"), []byte(`{}`))
+	}
+
+	w3 := db.Watch("farm", 5)
+	defer w3.Close()
+
+	for i := 0; i < watchBatchSize*2+1; i++ {
+		if !w3.Next() || w3.Event().Sequence != uint64(6+i) {
+			t.Fatalf("unmatch %d: %v", i, w3.Event())
+		}
+	}
+}
+
+func TestChangeLogRetention(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	options := NewOptions()
+	options.ChangeLog = true
+	options.ChangeLogRetention = 2
+
+	db, err := Open(tmpFile.Name(), 0600, options)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	bucket := db.Bucket("zoo")
+	for _, k := range []string{"a", "b", "c", "d"} {
+		bucket.PutRaw([]byte(k), []byte(`{}`))
+	}
+
+	w := db.Watch("zoo", 1)
+	if w.Next() {
+		t.Errorf("should not get any events: %v", w.Event())
+	}
+	if e, ok := w.Err().(*ErrChangeLogTruncated); !ok || e.FirstSequence != 3 {
+		t.Errorf("should raise ErrChangeLogTruncated: %v", w.Err())
+	}
+	w.Close()
+
+	w = db.Watch("zoo", 2)
+	defer w.Close()
+	if !w.Next() || string(w.Event().Key) != "c" {
+		t.Errorf("unmatch: %v", w.Event())
+	}
+
+	// the watcher that falls behind the retention is stopped instead of skipping the deleted events.
+	for _, k := range []string{"e", "f", "g", "h"} {
+		bucket.PutRaw([]byte(k), []byte(`{}`))
+	}
+	for w.Next() {
+		if w.Event().Sequence > 4 {
+			t.Errorf("should not get the events after the deleted events: %v", w.Event())
+		}
+	}
+	if e, ok := w.Err().(*ErrChangeLogTruncated); !ok || e.Sequence != 4 || e.FirstSequence != 7 {
+		t.Errorf("should raise ErrChangeLogTruncated: %v", w.Err())
+	}
+}
+
+func TestWatchWithoutChangeLog(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	w := db.Watch("zoo", 0)
+	defer w.Close()
+	if w.Next() {
+		t.Errorf("should not get any events")
+	}
+	if w.Err() == nil {
+		t.Errorf("should raise error")
+	}
+}
+
+func TestWatchAfterClose(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	options := NewOptions()
+	options.ChangeLog = true
+
+	db, err := Open(tmpFile.Name(), 0600, options)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	db.Bucket("zoo").PutRaw([]byte("key1"), []byte(`{"name": "joe"}`))
+
+	w := db.Watch("zoo", 0)
+	defer w.Close()
+	if !w.Next() || string(w.Event().Key) != "key1" {
+		t.Errorf("unmatch: %v", w.Event())
+	}
+
+	// the watcher waiting for the next event is woken up by closing the database.
+	next := make(chan bool, 1)
+	go func() {
+		next <- w.Next()
+	}()
+
+	if err := db.Close(); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	select {
+	case ok := <-next:
+		if ok {
+			t.Errorf("should not get any events")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the watcher should be stopped by closing the database")
+	}
+
+	if err := w.Err(); err != ErrDatabaseClosed {
+		t.Errorf("should be ErrDatabaseClosed: %v", err)
+	}
+}
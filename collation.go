@@ -0,0 +1,135 @@
+package bucketstore
+
+import (
+	"fmt"
+	"github.com/kohkimakimoto/bucketstore/v/text/cases"
+	"github.com/kohkimakimoto/bucketstore/v/text/unicode/norm"
+)
+
+// Unicode normalization forms of Collation.
+const (
+	NormalizationNone = ""
+	NormalizationNFC  = "NFC"
+	NormalizationNFKC = "NFKC"
+)
+
+// Collation is a normalization of string values in the index of a property.
+// The index keys and the arguments of the filters are normalized,
+// but the stored items keep their original values.
+type Collation struct {
+	// CaseInsensitive folds the case of strings.
+	CaseInsensitive bool `json:"case_insensitive,omitempty"`
+	// Normalization is a Unicode normalization form: NormalizationNone, NormalizationNFC or NormalizationNFKC.
+	Normalization string `json:"normalization,omitempty"`
+}
+
+func (c *Collation) validate() error {
+	switch c.Normalization {
+	case NormalizationNone, NormalizationNFC, NormalizationNFKC:
+		return nil
+	}
+
+	return fmt.Errorf("unsupported normalization: %s", c.Normalization)
+}
+
+func (c *Collation) normalize(s string) string {
+	s = c.normalizeForm(s)
+
+	if c.CaseInsensitive {
+		// the full case folding maps "ß" to "ss" and the final sigma to sigma unlike lowering.
+		// it may break the normalization form, so normalizes it again.
+		// a Caser is stateful, so it is created per call.
+		s = c.normalizeForm(cases.Fold().String(s))
+	}
+
+	return s
+}
+
+func (c *Collation) normalizeForm(s string) string {
+	switch c.Normalization {
+	case NormalizationNFC:
+		return norm.NFC.String(s)
+	case NormalizationNFKC:
+		return norm.NFKC.String(s)
+	}
+
+	return s
+}
+
+// indexValue converts the value of the property to the value to be indexed
+// by the integer declaration or the collation of the property.
+func (config *IndexConfig) indexValue(propName string, value interface{}) interface{} {
+	if config.isInteger(propName) {
+		if i, ok := toIndexInt(value); ok {
+			return i
+		}
+		return value
+	}
+
+	c, ok := config.Collations[propName]
+	if !ok {
+		return value
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+
+	return c.normalize(s)
+}
+
+// indexValue converts the value of the property to the value to be indexed
+// by the integer declaration or the collation of the property.
+func (b *BaseBucket) indexValue(propName string, value interface{}) (interface{}, error) {
+	config, err := b.IndexConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return config.indexValue(propName, value), nil
+}
+
+// SetCollation sets the collation of the string index of the property and rebuilds the index
+// and the compound indexes that include the property.
+// If the collation is nil, the strings are indexed as they are.
+func (b *BaseBucket) SetCollation(propName string, collation *Collation) error {
+	if collation != nil {
+		if err := collation.validate(); err != nil {
+			return err
+		}
+	}
+
+	config, err := b.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	if b.getIndexBucket(propName) != nil {
+		if err := b.deleteIndexBucket(propName); err != nil {
+			return err
+		}
+	}
+
+	if collation == nil {
+		delete(config.Collations, propName)
+	} else {
+		if config.Collations == nil {
+			config.Collations = map[string]*Collation{}
+		}
+		config.Collations[propName] = collation
+	}
+
+	if err := b.putIndexConfig(config); err != nil {
+		return err
+	}
+
+	err = b.backfillIndex(func(n string) bool {
+		return n == propName
+	})
+	if err != nil {
+		return err
+	}
+
+	return b.rebuildCompoundIndexes(propName)
+}
@@ -0,0 +1,130 @@
+package bucketstore
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestCollationNormalize(t *testing.T) {
+	cases := []struct {
+		collation *Collation
+		text      string
+		expected  string
+	}{
+		{&Collation{}, "Apple", "Apple"},
+		{&Collation{CaseInsensitive: true}, "ApPle", "apple"},
+		// the full case folding
+		{&Collation{CaseInsensitive: true}, "Straße", "strasse"},
+		{&Collation{CaseInsensitive: true}, "STRASSE", "strasse"},
+		{&Collation{CaseInsensitive: true}, "ὈΔΥΣΣΕΎΣ", "ὀδυσσεύσ"},
+		{&Collation{CaseInsensitive: true}, "Ὀδυσσεύς", "ὀδυσσεύσ"},
+		// "e" + combining acute accent
+		{&Collation{Normalization: NormalizationNFC}, "Café", "Café"},
+		// full width letters
+		{&Collation{Normalization: NormalizationNFKC, CaseInsensitive: true}, "ＡＰＰＬＥ", "apple"},
+		{&Collation{Normalization: NormalizationNFC}, "ＡＰＰＬＥ", "ＡＰＰＬＥ"},
+	}
+
+	for _, c := range cases {
+		if s := c.collation.normalize(c.text); s != c.expected {
+			t.Errorf("unmatch %q: %q (expected %q)", c.text, s, c.expected)
+		}
+	}
+}
+
+func TestCollationIndex(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	bucket := db.Bucket("fruits")
+	bucket.PutRaw([]byte("key1"), []byte(`{"name": "apple"}`))
+	bucket.PutRaw([]byte("key2"), []byte(`{"name": "Banana"}`))
+
+	// the existing items are reindexed.
+	if err := bucket.SetCollation("name", &Collation{CaseInsensitive: true, Normalization: NormalizationNFKC}); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	bucket.PutRaw([]byte("key3"), []byte(`{"name": "Apple"}`))
+	bucket.PutRaw([]byte("key4"), []byte(`{"name": "ＡＰＰＬＥ ＰＩＥ"}`))
+	bucket.PutRaw([]byte("key5"), []byte(`{"name": "cherry"}`))
+
+	cases := []struct {
+		filter   Filter
+		expected []string
+	}{
+		{&PropValueMatchFilter{Property: "name", Match: "APPLE"}, []string{"key1", "key3"}},
+		{&PropValuePrefixFilter{Property: "name", Prefix: "App"}, []string{"key1", "key3", "key4"}},
+		{&PropValueRangeFilter{Property: "name", Min: "B", Max: "CHERRY"}, []string{"key2", "key5"}},
+	}
+
+	for i, c := range cases {
+		q := bucket.Query()
+		q.Filter = c.filter
+		items, err := q.AsList()
+		if err != nil {
+			t.Errorf("should not raise error: %v", err)
+		}
+
+		keys := []string{}
+		for _, item := range items {
+			keys = append(keys, string(item.Key))
+		}
+
+		if !reflect.DeepEqual(keys, c.expected) {
+			t.Errorf("unmatch case %d: %v (expected %v)", i, keys, c.expected)
+		}
+	}
+
+	// the stored item keeps the original value.
+	v, _ := bucket.GetRaw([]byte("key3"))
+	if string(v) != `{"name":"Apple"}` {
+		t.Errorf("unmatch: %s", v)
+	}
+
+	// the unique constraint respects the collation.
+	bucket.Delete([]byte("key3"))
+	if err := bucket.AddUniqueIndex("name"); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if err := bucket.PutRaw([]byte("key6"), []byte(`{"name": "CHERRY"}`)); err == nil {
+		t.Errorf("should raise error")
+	}
+
+	// updating and deleting remove the normalized index.
+	bucket.PutRaw([]byte("key1"), []byte(`{"name": "Apricot"}`))
+	bucket.Delete([]byte("key4"))
+	q := bucket.Query()
+	q.Filter = &PropValuePrefixFilter{Property: "name", Prefix: "ap"}
+	if items, _ := q.AsList(); len(items) != 1 || string(items[0].Key) != "key1" {
+		t.Errorf("unmatch: %v", items)
+	}
+
+	// removing the collation reindexes the strings as they are.
+	if err := bucket.SetCollation("name", nil); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	q = bucket.Query()
+	q.Filter = &PropValueMatchFilter{Property: "name", Match: "banana"}
+	if count, _ := q.Count(); count != 0 {
+		t.Errorf("should be 0: %d", count)
+	}
+
+	if err := bucket.SetCollation("name", &Collation{Normalization: "NFD"}); err == nil {
+		t.Errorf("should raise error")
+	}
+}
@@ -0,0 +1,266 @@
+package bucketstore
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/kohkimakimoto/bucketstore/v/bolt"
+	"strings"
+)
+
+//
+// # Compound index key specification.
+//
+// A compound index is stored in the index bucket named by compoundIndexName.
+// The key concatenates the index key encoding of each property value, and the key of the item.
+// The values are converted by the integer declaration and the collation of each property in the same way as the single property indexes.
+//
+//   (<valueType> + <value> + <sep1> + <sep2>)... + <key>
+//
+// Items that don't have all of the properties are not indexed.
+// Array properties are not supported, so items that have multiple values of any property are not indexed.
+//
+
+// compoundIndexPrefix is a prefix of the names of compound index buckets.
+// Property names starting with '_' are never indexed, so it doesn't conflict with them.
+const compoundIndexPrefix = "_compound:"
+
+func compoundIndexName(propNames []string) string {
+	return compoundIndexPrefix + strings.Join(propNames, ",")
+}
+
+func isCompoundIndexName(name string) bool {
+	return strings.HasPrefix(name, compoundIndexPrefix)
+}
+
+// genCompoundIndexPrefix generates the index key part of the values of the leading properties.
+// The values are converted by the integer declaration and the collation of each property.
+// It returns nil if any value can't be indexed.
+func genCompoundIndexPrefix(config *IndexConfig, propNames []string, values []interface{}) []byte {
+	prefix := []byte{}
+	for i, v := range values {
+		valueBytes, valueType := toIndexedBytes(config.indexValue(propNames[i], v))
+		if valueType == valueTypeNoIndex {
+			return nil
+		}
+
+		prefix = append(prefix, genIndexPrefixForSeekFirst(valueType, valueBytes)...)
+	}
+
+	return prefix
+}
+
+// genCompoundIndexKey generates the compound index key of the item.
+// It returns nil if the item should not be indexed.
+func genCompoundIndexKey(config *IndexConfig, propNames []string, props map[string][]interface{}, key []byte) []byte {
+	values := make([]interface{}, 0, len(propNames))
+	for _, n := range propNames {
+		if len(props[n]) != 1 {
+			return nil
+		}
+
+		values = append(values, props[n][0])
+	}
+
+	prefix := genCompoundIndexPrefix(config, propNames, values)
+	if prefix == nil {
+		return nil
+	}
+
+	return append(prefix, key...)
+}
+
+// AddCompoundIndex declares the compound index over the ordered properties
+// and creates the index of the existing items.
+// The items that have multiple values of any of the properties by an array are not indexed,
+// so CompoundIndexFilter doesn't find them.
+func (b *BaseBucket) AddCompoundIndex(propNames ...string) error {
+	if len(propNames) < 2 {
+		return fmt.Errorf("compound index requires 2 or more properties")
+	}
+
+	for _, n := range propNames {
+		if n == "" || isIgnorePattern(n) || strings.Contains(n, ",") {
+			return fmt.Errorf("invalid property name to index: %s", n)
+		}
+	}
+
+	config, err := b.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	if config.hasCompound(propNames) {
+		return nil
+	}
+
+	config.Compound = append(config.Compound, propNames)
+	if err := b.putIndexConfig(config); err != nil {
+		return err
+	}
+
+	if !b.isIndexable() {
+		return nil
+	}
+
+	return b.backfillCompoundIndex(config, propNames)
+}
+
+// backfillCompoundIndex creates the compound index of the existing items.
+func (b *BaseBucket) backfillCompoundIndex(config *IndexConfig, propNames []string) error {
+	indexBucket, err := b.createIndexBucketIfNotExists(compoundIndexName(propNames))
+	if err != nil {
+		return err
+	}
+
+	return b.data.ForEach(func(key, value []byte) error {
+		var jsonMap map[string]interface{}
+		if err := decodeJSON(value, &jsonMap); err != nil {
+			return nil
+		}
+
+		indexKey := genCompoundIndexKey(config, propNames, flattenProperties(jsonMap), key)
+		if indexKey == nil {
+			return nil
+		}
+
+		return indexBucket.Put(indexKey, key)
+	})
+}
+
+// createCompoundIndexBuckets creates the buckets of the declared compound indexes that don't exist.
+func (b *BaseBucket) createCompoundIndexBuckets() error {
+	config, err := b.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	for _, propNames := range config.Compound {
+		if _, err := b.createIndexBucketIfNotExists(compoundIndexName(propNames)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rebuildCompoundIndexes rebuilds the compound indexes that include the property
+// after the conversion of the values of the property is changed.
+func (b *BaseBucket) rebuildCompoundIndexes(propName string) error {
+	config, err := b.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	for _, propNames := range config.Compound {
+		if !containsString(propNames, propName) {
+			continue
+		}
+
+		if b.getCompoundIndexBucket(propNames) != nil {
+			if err := b.deleteIndexBucket(compoundIndexName(propNames)); err != nil {
+				return err
+			}
+		}
+
+		if !b.isIndexable() {
+			continue
+		}
+
+		if err := b.backfillCompoundIndex(config, propNames); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DropCompoundIndex removes the declaration of the compound index and deletes the index.
+func (b *BaseBucket) DropCompoundIndex(propNames ...string) error {
+	config, err := b.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	if !config.hasCompound(propNames) {
+		return nil
+	}
+
+	compound := [][]string{}
+	for _, c := range config.Compound {
+		if compoundIndexName(c) != compoundIndexName(propNames) {
+			compound = append(compound, c)
+		}
+	}
+
+	config.Compound = compound
+	if err := b.putIndexConfig(config); err != nil {
+		return err
+	}
+
+	if b.getIndexBucket(compoundIndexName(propNames)) == nil {
+		return nil
+	}
+
+	return b.deleteIndexBucket(compoundIndexName(propNames))
+}
+
+// refreshCompoundIndex replaces the compound index keys of the item from the old value to the new value.
+// The old or new value can be nil.
+func (b *BaseBucket) refreshCompoundIndex(key []byte, oldJsonMap map[string]interface{}, jsonMap map[string]interface{}) error {
+	config, err := b.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	if len(config.Compound) == 0 {
+		return nil
+	}
+
+	var oldProps, props map[string][]interface{}
+	if oldJsonMap != nil {
+		oldProps = flattenProperties(oldJsonMap)
+	}
+	if jsonMap != nil {
+		props = flattenProperties(jsonMap)
+	}
+
+	for _, propNames := range config.Compound {
+		// the bucket is created by AddCompoundIndex. It is missing only if the index is broken,
+		// and RebuildIndexes recreates it.
+		indexBucket := b.getCompoundIndexBucket(propNames)
+		if indexBucket == nil {
+			continue
+		}
+
+		var oldIndexKey, indexKey []byte
+		if oldProps != nil {
+			oldIndexKey = genCompoundIndexKey(config, propNames, oldProps, key)
+		}
+		if props != nil {
+			indexKey = genCompoundIndexKey(config, propNames, props, key)
+		}
+
+		if bytes.Equal(oldIndexKey, indexKey) {
+			// unchanged.
+			continue
+		}
+
+		if oldIndexKey != nil {
+			if err := indexBucket.Delete(oldIndexKey); err != nil {
+				return err
+			}
+		}
+
+		if indexKey != nil {
+			if err := indexBucket.Put(indexKey, key); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (b *BaseBucket) getCompoundIndexBucket(propNames []string) *bolt.Bucket {
+	return b.getIndexBucket(compoundIndexName(propNames))
+}
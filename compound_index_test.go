@@ -0,0 +1,316 @@
+package bucketstore
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestCompoundIndexFilter(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	bucket := db.Bucket("tasks")
+	bucket.PutRaw([]byte("key1"), []byte(`{"status": "active", "created_at": 30, "owner": {"name": "joe"}}`))
+	bucket.PutRaw([]byte("key2"), []byte(`{"status": "done", "created_at": 10, "owner": {"name": "joe"}}`))
+	bucket.PutRaw([]byte("key3"), []byte(`{"status": "active", "created_at": 10, "owner": {"name": "foo"}}`))
+
+	// the existing items are indexed.
+	if err := bucket.AddCompoundIndex("status", "created_at"); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if err := bucket.AddCompoundIndex("status", "owner.name", "created_at"); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	bucket.PutRaw([]byte("key4"), []byte(`{"status": "active", "created_at": -5, "owner": {"name": "joe"}}`))
+	bucket.PutRaw([]byte("key5"), []byte(`{"status": "active", "created_at": 20, "owner": {"name": "joe"}}`))
+	// items that don't have all properties are not indexed.
+	bucket.PutRaw([]byte("key6"), []byte(`{"status": "active"}`))
+	// items that have multiple values of a property are not indexed.
+	bucket.PutRaw([]byte("key8"), []byte(`{"status": "active", "created_at": [60, 70], "owner": {"name": "joe"}}`))
+	// updating the item replaces the index.
+	bucket.PutRaw([]byte("key2"), []byte(`{"status": "active", "created_at": 40, "owner": {"name": "foo"}}`))
+	// deleting the item removes the index.
+	bucket.PutRaw([]byte("key7"), []byte(`{"status": "active", "created_at": 50}`))
+	bucket.Delete([]byte("key7"))
+
+	cases := []struct {
+		filter   *CompoundIndexFilter
+		expected []string
+	}{
+		{
+			&CompoundIndexFilter{Properties: []string{"status", "created_at"}, Match: []interface{}{"active"}},
+			[]string{"key4", "key3", "key5", "key1", "key2"},
+		},
+		{
+			&CompoundIndexFilter{Properties: []string{"status", "created_at"}, Match: []interface{}{"active"}, OrderBy: OrderByDesc},
+			[]string{"key2", "key1", "key5", "key3", "key4"},
+		},
+		{
+			&CompoundIndexFilter{Properties: []string{"status", "created_at"}, Match: []interface{}{"active"}, Min: 10, Max: 30},
+			[]string{"key3", "key5", "key1"},
+		},
+		{
+			&CompoundIndexFilter{Properties: []string{"status", "created_at"}, Match: []interface{}{"active"}, Min: 10, Max: 30, OrderBy: OrderByDesc},
+			[]string{"key1", "key5", "key3"},
+		},
+		{
+			&CompoundIndexFilter{Properties: []string{"status", "created_at"}, Match: []interface{}{"active"}, Min: 15},
+			[]string{"key5", "key1", "key2"},
+		},
+		{
+			&CompoundIndexFilter{Properties: []string{"status", "created_at"}, Match: []interface{}{"active"}, Max: 15, OrderBy: OrderByDesc},
+			[]string{"key3", "key4"},
+		},
+		{
+			&CompoundIndexFilter{Properties: []string{"status", "created_at"}, Min: "b", Max: "z"},
+			[]string{},
+		},
+		{
+			&CompoundIndexFilter{Properties: []string{"status", "owner.name", "created_at"}, Match: []interface{}{"active", "joe"}, OrderBy: OrderByDesc},
+			[]string{"key1", "key5", "key4"},
+		},
+		{
+			&CompoundIndexFilter{Properties: []string{"status", "owner.name", "created_at"}, Match: []interface{}{"active", "foo", 40}},
+			[]string{"key2"},
+		},
+		{
+			&CompoundIndexFilter{Properties: []string{"status", "owner.name"}, Match: []interface{}{"active"}},
+			[]string{},
+		},
+	}
+
+	for i, c := range cases {
+		q := bucket.Query()
+		q.Filter = c.filter
+		items, err := q.AsList()
+		if err != nil {
+			t.Errorf("should not raise error: %v", err)
+		}
+
+		keys := []string{}
+		for _, item := range items {
+			keys = append(keys, string(item.Key))
+		}
+
+		if !reflect.DeepEqual(keys, c.expected) {
+			t.Errorf("unmatch case %d: %v (expected %v)", i, keys, c.expected)
+		}
+	}
+
+	// pagination
+	keys := []string{}
+	token := ""
+	for i := 0; i < 5; i++ {
+		q := bucket.Query()
+		q.Filter = &CompoundIndexFilter{Properties: []string{"status", "created_at"}, Match: []interface{}{"active"}, Min: 10, OrderBy: OrderByDesc}
+		q.Limit = 2
+		q.After = token
+		items, err := q.AsList()
+		if err != nil {
+			t.Errorf("should not raise error: %v", err)
+		}
+		if len(items) == 0 {
+			break
+		}
+		for _, item := range items {
+			keys = append(keys, string(item.Key))
+		}
+		token = q.Token()
+	}
+	if !reflect.DeepEqual(keys, []string{"key2", "key1", "key5", "key3"}) {
+		t.Errorf("unmatch: %v", keys)
+	}
+
+	// too many values
+	q := bucket.Query()
+	q.Filter = &CompoundIndexFilter{Properties: []string{"status", "created_at"}, Match: []interface{}{"active", 10}, Min: 1}
+	if _, err := q.AsList(); err == nil {
+		t.Errorf("should raise error")
+	}
+
+	// compound indexes are not properties.
+	err = db.View(func(tx *Tx) error {
+		b, _ := tx.Bucket("tasks")
+		props, err := b.BaseBucket().IndexProperties()
+		for _, p := range props {
+			if isCompoundIndexName(p) {
+				t.Errorf("should not include compound index: %v", props)
+			}
+		}
+		return err
+	})
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	if err := bucket.AddCompoundIndex("status"); err == nil {
+		t.Errorf("should raise error")
+	}
+
+	if err := bucket.DropCompoundIndex("status", "created_at"); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	q = bucket.Query()
+	q.Filter = &CompoundIndexFilter{Properties: []string{"status", "created_at"}, Match: []interface{}{"active"}}
+	if count, _ := q.Count(); count != 0 {
+		t.Errorf("should be 0: %d", count)
+	}
+}
+
+func TestCompoundIndexCollation(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	bucket := db.Bucket("users")
+	bucket.AddCompoundIndex("country", "name")
+	bucket.PutRaw([]byte("key1"), []byte(`{"country": "JP", "name": "Bob"}`))
+	bucket.PutRaw([]byte("key2"), []byte(`{"country": "jp", "name": "alice"}`))
+	bucket.PutRaw([]byte("key3"), []byte(`{"country": "Jp", "name": "Carol"}`))
+	bucket.PutRaw([]byte("key4"), []byte(`{"country": "us", "name": "dave"}`))
+
+	// setting the collation rebuilds the compound index.
+	if err := bucket.SetCollation("country", &Collation{CaseInsensitive: true}); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if err := bucket.SetCollation("name", &Collation{CaseInsensitive: true}); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	bucket.PutRaw([]byte("key5"), []byte(`{"country": "JP", "name": "ALAN"}`))
+
+	cases := []struct {
+		filter   *CompoundIndexFilter
+		expected []string
+	}{
+		{
+			&CompoundIndexFilter{Properties: []string{"country", "name"}, Match: []interface{}{"jP"}},
+			[]string{"key5", "key2", "key1", "key3"},
+		},
+		{
+			&CompoundIndexFilter{Properties: []string{"country", "name"}, Match: []interface{}{"JP"}, Min: "B", Max: "CAROL"},
+			[]string{"key1", "key3"},
+		},
+		{
+			&CompoundIndexFilter{Properties: []string{"country", "name"}, Match: []interface{}{"Jp", "ALICE"}},
+			[]string{"key2"},
+		},
+	}
+
+	for i, c := range cases {
+		q := bucket.Query()
+		q.Filter = c.filter
+		items, err := q.AsList()
+		if err != nil {
+			t.Errorf("should not raise error: %v", err)
+		}
+
+		keys := []string{}
+		for _, item := range items {
+			keys = append(keys, string(item.Key))
+		}
+
+		if !reflect.DeepEqual(keys, c.expected) {
+			t.Errorf("unmatch case %d: %v (expected %v)", i, keys, c.expected)
+		}
+	}
+
+	report, err := db.CheckIndexes("users")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("should be ok: %v", report)
+	}
+}
+
+func TestCompoundIndexInteger(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	// the ids above 2^53 can't be distinguished as float64.
+	bucket := db.Bucket("events")
+	bucket.AddCompoundIndex("type", "id")
+	bucket.PutRaw([]byte("key1"), []byte(`{"type": "click", "id": 9007199254740993}`))
+	bucket.PutRaw([]byte("key2"), []byte(`{"type": "click", "id": 9007199254740992}`))
+
+	// declaring the integer rebuilds the compound index.
+	if err := bucket.AddIntegerIndex("id"); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	bucket.PutRaw([]byte("key3"), []byte(`{"type": "click", "id": 9007199254740994}`))
+	bucket.PutRaw([]byte("key4"), []byte(`{"type": "click", "id": -1}`))
+
+	cases := []struct {
+		filter   *CompoundIndexFilter
+		expected []string
+	}{
+		{
+			&CompoundIndexFilter{Properties: []string{"type", "id"}, Match: []interface{}{"click"}},
+			[]string{"key4", "key2", "key1", "key3"},
+		},
+		{
+			&CompoundIndexFilter{Properties: []string{"type", "id"}, Match: []interface{}{"click", int64(9007199254740993)}},
+			[]string{"key1"},
+		},
+		{
+			&CompoundIndexFilter{Properties: []string{"type", "id"}, Match: []interface{}{"click"}, Min: int64(9007199254740993), Max: int64(9007199254740994), OrderBy: OrderByDesc},
+			[]string{"key3", "key1"},
+		},
+	}
+
+	for i, c := range cases {
+		q := bucket.Query()
+		q.Filter = c.filter
+		items, err := q.AsList()
+		if err != nil {
+			t.Errorf("should not raise error: %v", err)
+		}
+
+		keys := []string{}
+		for _, item := range items {
+			keys = append(keys, string(item.Key))
+		}
+
+		if !reflect.DeepEqual(keys, c.expected) {
+			t.Errorf("unmatch case %d: %v (expected %v)", i, keys, c.expected)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package bucketstore
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+//
+// # CSV specification.
+//
+// A bucket is exported to CSV that has a header row. Each row after the header is an item.
+// The header has the property paths of the columns like 'address.city', and the key column if it is specified.
+//
+//   _key,address.city,age,name
+//   key1,Tokyo,5,joe
+//
+// The cells are converted from the values of the properties as follows.
+//
+//   string          : as it is
+//   number          : the JSON literal
+//   boolean         : true or false
+//   null            : null
+//   object or array : the JSON text
+//   missing         : the empty cell
+//
+// Importing infers the types of the cells in reverse, except objects and arrays that are imported as strings.
+// If the type inference is disabled, all cells are imported as strings.
+// The empty cells are not imported.
+// The keys are encoded in the same way as JSON Lines.
+//
+
+// CSVOptions is options of importing and exporting items as CSV.
+type CSVOptions struct {
+	// KeyColumn is the name of the column of the keys.
+	// If it is empty, exporting doesn't write the keys, and importing generates the keys by the sequence of the bucket.
+	KeyColumn string
+	// Columns are the property paths of the columns to export.
+	// If it is empty, all properties of the items are exported in the name order.
+	// Importing uses the header row instead.
+	Columns []string
+	// NoTypeInference makes importing put all cells as strings.
+	// It keeps the strings like '007' and 'true' that are exported from string values.
+	NoTypeInference bool
+}
+
+// ExportCSV writes the items of the bucket to the writer as CSV in the key order.
+// It returns the number of the written items. Expired items are not exported.
+func (bucket *Bucket) ExportCSV(w io.Writer, csvOpts *CSVOptions) (n int, err error) {
+	if csvOpts == nil {
+		csvOpts = &CSVOptions{}
+	}
+
+	if bucket.baseBucket != nil {
+		return bucket.baseBucket.exportCSV(w, csvOpts)
+	}
+
+	err = bucket.datastore.View(func(tx *Tx) error {
+		baseBucket, err := tx.baseBucket([]byte(bucket.name))
+		if err != nil {
+			return err
+		}
+
+		if baseBucket == nil {
+			return nil
+		}
+
+		n, err = baseBucket.exportCSV(w, csvOpts)
+		return err
+	})
+
+	return n, err
+}
+
+func (b *BaseBucket) exportCSV(w io.Writer, csvOpts *CSVOptions) (int, error) {
+	if b.ValueMode() == ValueModeRaw {
+		return 0, fmt.Errorf("the bucket in the raw mode can't be exported as CSV")
+	}
+
+	now := timeNow()
+
+	forEachObject := func(fn func(key []byte, m map[string]interface{}) error) error {
+		return b.ForEach(func(k, v []byte) error {
+			if b.isExpired(k, now) {
+				return nil
+			}
+
+			var m map[string]interface{}
+			if err := decodeJSON(v, &m); err != nil {
+				return fmt.Errorf("the item %q is not a json object: %v", string(k), err)
+			}
+
+			return fn(k, m)
+		})
+	}
+
+	columns := csvOpts.Columns
+	if len(columns) == 0 {
+		paths := map[string]bool{}
+		err := forEachObject(func(key []byte, m map[string]interface{}) error {
+			collectLeafPaths(paths, "", m)
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		for path := range paths {
+			columns = append(columns, path)
+		}
+		sort.Strings(columns)
+	}
+
+	if csvOpts.KeyColumn != "" && containsString(columns, csvOpts.KeyColumn) {
+		return 0, fmt.Errorf("the key column %s conflicts with the property", csvOpts.KeyColumn)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader(csvOpts.KeyColumn, columns)); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	err := forEachObject(func(key []byte, m map[string]interface{}) error {
+		row := []string{}
+		if csvOpts.KeyColumn != "" {
+			row = append(row, encodeBytes(key))
+		}
+
+		for _, path := range columns {
+			cell, err := csvCell(m, path)
+			if err != nil {
+				return err
+			}
+			row = append(row, cell)
+		}
+
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+
+		n++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	cw.Flush()
+	return n, cw.Error()
+}
+
+// ImportCSV reads the items from CSV that has a header row and puts them into the bucket in batched write transactions.
+// The header row maps the columns to the property paths.
+// The items written by the previous batches remain if it fails.
+// In a transaction, all items are put in the transaction.
+func (bucket *Bucket) ImportCSV(r io.Reader, csvOpts *CSVOptions, opts *ImportOptions) (*ImportResult, error) {
+	if csvOpts == nil {
+		csvOpts = &CSVOptions{}
+	}
+
+	cr := csv.NewReader(r)
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return &ImportResult{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("invalid header: %v", err)
+	}
+
+	keyIndex := -1
+	for i, column := range header {
+		if column == "" {
+			return nil, fmt.Errorf("invalid header: the column %d doesn't have the name", i+1)
+		}
+
+		if containsString(header[:i], column) {
+			return nil, fmt.Errorf("invalid header: the column %s is duplicated", column)
+		}
+
+		if column == csvOpts.KeyColumn {
+			keyIndex = i
+		}
+	}
+
+	if csvOpts.KeyColumn != "" && keyIndex < 0 {
+		return nil, fmt.Errorf("invalid header: the key column %s doesn't exist", csvOpts.KeyColumn)
+	}
+
+	n := 0
+	return bucket.importRecords(opts, func() (importRecord, error) {
+		n++
+
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid item %d: %v", n, err)
+		}
+
+		return &csvRecord{header: header, keyIndex: keyIndex, row: row, noTypeInference: csvOpts.NoTypeInference}, nil
+	})
+}
+
+// csvRecord is a row of CSV.
+type csvRecord struct {
+	header          []string
+	keyIndex        int
+	row             []string
+	noTypeInference bool
+}
+
+func (record *csvRecord) item(b *BaseBucket) ([]byte, []byte, error) {
+	if b.ValueMode() == ValueModeRaw {
+		return nil, nil, fmt.Errorf("the bucket in the raw mode can't be imported from CSV")
+	}
+
+	var key []byte
+	m := map[string]interface{}{}
+	for i, cell := range record.row {
+		if i == record.keyIndex {
+			k, err := decodeBytes(cell)
+			if err != nil {
+				return nil, nil, err
+			}
+			key = k
+			continue
+		}
+
+		if cell == "" {
+			continue
+		}
+
+		var v interface{} = cell
+		if !record.noTypeInference {
+			v = inferCSVValue(cell)
+		}
+
+		if err := setPath(m, record.header[i], v); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	value, err := json.Marshal(m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, value, nil
+}
+
+func csvHeader(keyColumn string, columns []string) []string {
+	if keyColumn == "" {
+		return columns
+	}
+
+	return append([]string{keyColumn}, columns...)
+}
+
+// collectLeafPaths collects the paths of the values that are not objects in the same way as flattenProperties.
+// Arrays and empty objects are leaves.
+func collectLeafPaths(paths map[string]bool, prefix string, m map[string]interface{}) {
+	for n, v := range m {
+		if child, ok := v.(map[string]interface{}); ok && len(child) > 0 {
+			collectLeafPaths(paths, prefix+n+".", child)
+			continue
+		}
+
+		paths[prefix+n] = true
+	}
+}
+
+// csvCell gets the cell of the value at the path.
+func csvCell(m map[string]interface{}, path string) (string, error) {
+	var v interface{} = m
+	for _, n := range strings.Split(path, ".") {
+		child, ok := v.(map[string]interface{})
+		if !ok {
+			return "", nil
+		}
+
+		v, ok = child[n]
+		if !ok {
+			return "", nil
+		}
+	}
+
+	switch converted := v.(type) {
+	case nil:
+		return "null", nil
+	case string:
+		return converted, nil
+	case bool:
+		if converted {
+			return "true", nil
+		}
+		return "false", nil
+	case json.Number:
+		return converted.String(), nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// inferCSVValue converts the cell to the JSON value.
+// Numbers, booleans and null are the types that are indexed as they are.
+func inferCSVValue(cell string) interface{} {
+	switch cell {
+	case "null":
+		return nil
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+
+	var v interface{}
+	if err := decodeJSON([]byte(cell), &v); err == nil {
+		// only the exact JSON number literals like '-1.5e3'. '007' and ' 1' are strings.
+		if number, ok := v.(json.Number); ok && number.String() == cell {
+			return number
+		}
+	}
+
+	return cell
+}
+
+// setPath sets the value at the dotted property path creating the parent objects.
+func setPath(m map[string]interface{}, path string, value interface{}) error {
+	names := strings.Split(path, ".")
+	for _, n := range names[:len(names)-1] {
+		child, ok := m[n]
+		if !ok {
+			child = map[string]interface{}{}
+			m[n] = child
+		}
+
+		childMap, ok := child.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("the property path %s conflicts with the other column", path)
+		}
+		m = childMap
+	}
+
+	last := names[len(names)-1]
+	if _, ok := m[last]; ok {
+		return fmt.Errorf("the property path %s conflicts with the other column", path)
+	}
+
+	m[last] = value
+	return nil
+}
@@ -0,0 +1,125 @@
+package bucketstore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBucketExportAndImportCSV(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	zoo := db.Bucket("zoo")
+	zoo.PutRaw([]byte("key1"), []byte(`{"name": "joe", "address": {"city": "Tokyo"}, "age": 5, "male": true, "tags": ["a", "b"]}`))
+	zoo.PutRaw([]byte("key2"), []byte(`{"name": "foo, jr.", "age": 12345678901234567890, "male": false, "note": null}`))
+
+	var buf bytes.Buffer
+	n, err := zoo.ExportCSV(&buf, &CSVOptions{KeyColumn: "_key"})
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("should be 2: %d", n)
+	}
+
+	expected := `_key,address.city,age,male,name,note,tags
+key1,Tokyo,5,true,joe,,"[""a"",""b""]"
+key2,,12345678901234567890,false,"foo, jr.",null,
+`
+	if buf.String() != expected {
+		t.Errorf("unmatch: %s", buf.String())
+	}
+
+	farm := db.Bucket("farm")
+	result, err := farm.ImportCSV(bytes.NewReader(buf.Bytes()), &CSVOptions{KeyColumn: "_key"}, &ImportOptions{BatchSize: 1})
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if result.Imported != 2 {
+		t.Errorf("should be 2: %d", result.Imported)
+	}
+
+	if v, _ := farm.GetRaw([]byte("key1")); string(v) != `{"address":{"city":"Tokyo"},"age":5,"male":true,"name":"joe","tags":"[\"a\",\"b\"]"}` {
+		t.Errorf("unmatch: %s", v)
+	}
+	if v, _ := farm.GetRaw([]byte("key2")); string(v) != `{"age":12345678901234567890,"male":false,"name":"foo, jr.","note":null}` {
+		t.Errorf("unmatch: %s", v)
+	}
+
+	// the selected columns without the keys.
+	buf.Reset()
+	if _, err := zoo.ExportCSV(&buf, &CSVOptions{Columns: []string{"name", "address.city"}}); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if buf.String() != "name,address.city\njoe,Tokyo\n\"foo, jr.\",\n" {
+		t.Errorf("unmatch: %s", buf.String())
+	}
+
+	// the keys are generated by the sequence.
+	input := "name,zip,score\njoe,007,1.5e3\n"
+	house := db.Bucket("house")
+	if _, err := house.ImportCSV(strings.NewReader(input), nil, nil); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if v, _ := house.GetRaw(Uint64ToBytes(1)); string(v) != `{"name":"joe","score":1.5e3,"zip":"007"}` {
+		t.Errorf("unmatch: %s", v)
+	}
+
+	// the inferred types are indexed.
+	q := house.Query()
+	q.Filter = &PropValueMatchFilter{Property: "score", Match: 1500.0}
+	if count, _ := q.Count(); count != 1 {
+		t.Errorf("should be 1: %d", count)
+	}
+
+	// the strings that look like the other types are kept without the type inference.
+	zoo.PutRaw([]byte("key3"), []byte(`{"zip": "007", "flag": "true", "count": "5"}`))
+	buf.Reset()
+	if _, err := zoo.ExportCSV(&buf, &CSVOptions{KeyColumn: "_key", Columns: []string{"zip", "flag", "count"}}); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	garden := db.Bucket("garden")
+	if _, err := garden.ImportCSV(bytes.NewReader(buf.Bytes()), &CSVOptions{KeyColumn: "_key", NoTypeInference: true}, nil); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if v, _ := garden.GetRaw([]byte("key3")); string(v) != `{"count":"5","flag":"true","zip":"007"}` {
+		t.Errorf("unmatch: %s", v)
+	}
+	if v, _ := garden.GetRaw([]byte("key1")); string(v) != `{}` {
+		t.Errorf("unmatch: %s", v)
+	}
+
+	// the inference converts them.
+	if _, err := house.ImportCSV(bytes.NewReader(buf.Bytes()), &CSVOptions{KeyColumn: "_key"}, nil); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if v, _ := house.GetRaw([]byte("key3")); string(v) != `{"count":5,"flag":true,"zip":"007"}` {
+		t.Errorf("unmatch: %s", v)
+	}
+
+	if _, err := house.ImportCSV(strings.NewReader("name,age\njoe,5\n"), &CSVOptions{KeyColumn: "_key"}, nil); err == nil {
+		t.Errorf("should raise error")
+	}
+	if _, err := house.ImportCSV(strings.NewReader("a,a.b\n1,2\n"), nil, nil); err == nil {
+		t.Errorf("should raise error")
+	}
+	if _, err := house.ImportCSV(strings.NewReader("name,name\n1,2\n"), nil, nil); err == nil {
+		t.Errorf("should raise error")
+	}
+}
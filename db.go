@@ -1,9 +1,11 @@
 package bucketstore
 
 import (
+	"errors"
 	"fmt"
 	"github.com/kohkimakimoto/bucketstore/v/bolt"
 	"os"
+	"sync"
 )
 
 var (
@@ -15,14 +17,58 @@ var (
 	bIndex = []byte("i")
 	// bBucketsList is a bucket to store buckets list.
 	bBucketsList = []byte("b")
+	// bIndexConfig is a bucket to store index configurations of buckets.
+	bIndexConfig = []byte("c")
+	// bSchemas is a bucket to store JSON Schemas of buckets.
+	bSchemas = []byte("s")
+	// bValueModes is a bucket to store value modes of buckets.
+	bValueModes = []byte("v")
+	// bRevisions is a bucket to store revisions of items per bucket.
+	bRevisions = []byte("r")
+	// bExpiries is a bucket to store expiries of items per bucket.
+	bExpiries = []byte("e")
+	// bChanges is a bucket to store the change log.
+	bChanges = []byte("l")
+	// bMetadata is a bucket to store metadata of the database.
+	bMetadata = []byte("m")
 )
 
 type DB struct {
 	// conn is the underlying handle to the Datastore.
 	conn    *bolt.DB
 	options *Options
+	// indexVersion is the index version of the database. It is older than the current version
+	// if an old database is opened in the read only mode.
+	indexVersion uint64
+
+	// reaperStop and reaperDone control the goroutine to delete expired items.
+	reaperStop chan struct{}
+	reaperDone chan struct{}
+
+	// changeNotify is closed when changes are committed to wake up the watchers.
+	changeNotify chan struct{}
+	changeMutex  sync.Mutex
+
+	// closed is closed when the database is closed to stop the watchers.
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	// hooks is the hooks of writes per bucket name.
+	hooks      map[string]*bucketHooks
+	hooksMutex sync.RWMutex
+
+	// iterations is the running iterators that are stopped by closing the database.
+	iterations      map[*iteration]struct{}
+	iterationsMutex sync.Mutex
+
+	// rebuilding is the names of the buckets whose indexes are being rebuilt.
+	rebuilding      map[string]bool
+	rebuildingMutex sync.Mutex
 }
 
+// ErrDatabaseClosed is returned when the database is closed while it is used.
+var ErrDatabaseClosed = errors.New("the database is closed")
+
 func Open(path string, mode os.FileMode, options *Options) (*DB, error) {
 	if options == nil {
 		options = NewOptions()
@@ -45,8 +91,10 @@ func Open(path string, mode os.FileMode, options *Options) (*DB, error) {
 func open(handle *bolt.DB, options *Options) (*DB, error) {
 	// Create the new store
 	db := &DB{
-		conn:    handle,
-		options: options,
+		conn:         handle,
+		options:      options,
+		indexVersion: indexVersion,
+		closed:       make(chan struct{}),
 	}
 
 	if !db.conn.IsReadOnly() {
@@ -70,9 +118,41 @@ func open(handle *bolt.DB, options *Options) (*DB, error) {
 		if _, err := tx.CreateBucketIfNotExists(bBucketsList); err != nil {
 			return nil, err
 		}
+		if _, err := tx.CreateBucketIfNotExists(bIndexConfig); err != nil {
+			return nil, err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bSchemas); err != nil {
+			return nil, err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bValueModes); err != nil {
+			return nil, err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bRevisions); err != nil {
+			return nil, err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bExpiries); err != nil {
+			return nil, err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bChanges); err != nil {
+			return nil, err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bMetadata); err != nil {
+			return nil, err
+		}
+		if err := migrate(tx); err != nil {
+			return nil, err
+		}
 		if err := tx.Commit(); err != nil {
 			return nil, err
 		}
+	} else {
+		if err := db.conn.View(db.checkIndexVersion); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.ReaperInterval > 0 && !db.conn.IsReadOnly() {
+		db.startReaper(options.ReaperInterval)
 	}
 
 	return db, nil
@@ -97,9 +177,46 @@ func (db *DB) Conn() *bolt.DB {
 }
 
 func (db *DB) Close() error {
+	db.closeOnce.Do(func() {
+		close(db.closed)
+	})
+	db.stopReaper()
+	db.stopIterations()
 	return db.conn.Close()
 }
 
+func (db *DB) addIteration(iter *iteration) {
+	db.iterationsMutex.Lock()
+	defer db.iterationsMutex.Unlock()
+
+	if db.iterations == nil {
+		db.iterations = map[*iteration]struct{}{}
+	}
+	db.iterations[iter] = struct{}{}
+}
+
+func (db *DB) removeIteration(iter *iteration) {
+	db.iterationsMutex.Lock()
+	defer db.iterationsMutex.Unlock()
+
+	delete(db.iterations, iter)
+}
+
+// stopIterations stops the running iterators and waits for them to release the transactions.
+func (db *DB) stopIterations() {
+	db.iterationsMutex.Lock()
+	iterations := []*iteration{}
+	for iter := range db.iterations {
+		iterations = append(iterations, iter)
+	}
+	db.iterationsMutex.Unlock()
+
+	for _, iter := range iterations {
+		iter.stop(ErrDatabaseClosed)
+		<-iter.exited
+	}
+}
+
 func (db *DB) Begin(writable bool) (*Tx, error) {
 	t, err := db.conn.Begin(writable)
 	if err != nil {
@@ -0,0 +1,307 @@
+package bucketstore
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//
+// # JSON Lines specification.
+//
+// A bucket is exported to JSON Lines. Each line is an item.
+//
+//   {"key": <key>, "value": <value>}
+//
+// The key is a string if it is a printable UTF-8 string that doesn't start with "0x",
+// otherwise it is "0x" followed by the hex encoded bytes.
+// The value is the JSON value of the item.
+// In the raw mode, the value is a string of the bytes encoded in the same way as the key.
+//
+
+// ImportMode is a mode to decide how existing items are treated by importing.
+type ImportMode string
+
+const (
+	// ImportModeUpsert overwrites existing items. It is the default mode.
+	ImportModeUpsert ImportMode = "upsert"
+	// ImportModeSkipExisting doesn't import items whose keys exist.
+	ImportModeSkipExisting ImportMode = "skip-existing"
+)
+
+// defaultImportBatchSize is the number of items put in a write transaction by default.
+const defaultImportBatchSize = 1000
+
+// ImportOptions is options of importing items.
+type ImportOptions struct {
+	Mode ImportMode
+	// BatchSize is the number of items put in a write transaction.
+	// If it is 0, 1000 is used. It is ignored in a transaction.
+	BatchSize int
+	// Progress is called after each batch is written.
+	Progress func(result *ImportResult)
+}
+
+// ImportResult is the numbers of the items processed by importing.
+type ImportResult struct {
+	// Read is the number of the read items.
+	Read int
+	// Imported is the number of the put items.
+	Imported int
+	// Skipped is the number of the items skipped because they exist.
+	Skipped int
+}
+
+// jsonLine is an item of JSON Lines.
+type jsonLine struct {
+	Key   *string         `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Export writes the items of the bucket to the writer as JSON Lines in the key order.
+// It returns the number of the written items. Expired items are not exported.
+func (bucket *Bucket) Export(w io.Writer) (n int, err error) {
+	if bucket.baseBucket != nil {
+		return bucket.baseBucket.export(w)
+	}
+
+	err = bucket.datastore.View(func(tx *Tx) error {
+		baseBucket, err := tx.baseBucket([]byte(bucket.name))
+		if err != nil {
+			return err
+		}
+
+		if baseBucket == nil {
+			return nil
+		}
+
+		n, err = baseBucket.export(w)
+		return err
+	})
+
+	return n, err
+}
+
+func (b *BaseBucket) export(w io.Writer) (int, error) {
+	raw := b.ValueMode() == ValueModeRaw
+	now := timeNow()
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	n := 0
+	err := b.ForEach(func(k, v []byte) error {
+		if b.isExpired(k, now) {
+			return nil
+		}
+
+		key := encodeBytes(k)
+		line := &jsonLine{Key: &key, Value: v}
+		if raw {
+			value, err := json.Marshal(encodeBytes(v))
+			if err != nil {
+				return err
+			}
+			line.Value = value
+		}
+
+		// the encoder compacts the value, so that the value formatted with newlines is written in a line.
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+
+		n++
+		return nil
+	})
+
+	return n, err
+}
+
+// Import reads the items from JSON Lines and puts them into the bucket in batched write transactions.
+// The items written by the previous batches remain if it fails.
+// In a transaction, all items are put in the transaction.
+func (bucket *Bucket) Import(r io.Reader, opts *ImportOptions) (*ImportResult, error) {
+	dec := json.NewDecoder(r)
+
+	n := 0
+	return bucket.importRecords(opts, func() (importRecord, error) {
+		n++
+
+		line := &jsonLine{}
+		if err := dec.Decode(line); err == io.EOF {
+			return nil, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid item %d: %v", n, err)
+		}
+
+		if line.Key == nil || line.Value == nil {
+			return nil, fmt.Errorf("invalid item %d: the item must have the key and the value", n)
+		}
+
+		return line, nil
+	})
+}
+
+// importRecord is a record read by importing.
+type importRecord interface {
+	// item gets the key and the value of the item to put into the bucket.
+	// If the key is nil, it is generated by the sequence of the bucket.
+	item(b *BaseBucket) (key []byte, value []byte, err error)
+}
+
+// importRecords puts the records got by the next function into the bucket in batched write transactions.
+// The next function returns nil at the end.
+func (bucket *Bucket) importRecords(opts *ImportOptions, next func() (importRecord, error)) (*ImportResult, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+
+	mode := opts.Mode
+	switch mode {
+	case "":
+		mode = ImportModeUpsert
+	case ImportModeUpsert, ImportModeSkipExisting:
+	default:
+		return nil, fmt.Errorf("unsupported import mode: %s", mode)
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultImportBatchSize
+	}
+
+	result := &ImportResult{}
+	for {
+		records := []importRecord{}
+		for len(records) < batchSize {
+			record, err := next()
+			if err != nil {
+				return result, err
+			}
+
+			if record == nil {
+				break
+			}
+
+			records = append(records, record)
+		}
+
+		if len(records) == 0 {
+			break
+		}
+
+		batch := &ImportResult{}
+		err := bucket.updateBaseBucket(func(baseBucket *BaseBucket) error {
+			for i, record := range records {
+				if err := baseBucket.importRecord(record, mode, batch); err != nil {
+					return fmt.Errorf("invalid item %d: %v", result.Read+i+1, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+
+		result.Read += batch.Read
+		result.Imported += batch.Imported
+		result.Skipped += batch.Skipped
+
+		if opts.Progress != nil {
+			progress := *result
+			opts.Progress(&progress)
+		}
+
+		if len(records) < batchSize {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+func (b *BaseBucket) importRecord(record importRecord, mode ImportMode, result *ImportResult) error {
+	result.Read++
+
+	key, value, err := record.item(b)
+	if err != nil {
+		return err
+	}
+
+	if key == nil {
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		key = Uint64ToBytes(seq)
+	}
+
+	if len(key) == 0 {
+		return fmt.Errorf("the key must not be empty")
+	}
+
+	if mode == ImportModeSkipExisting && b.Get(key) != nil {
+		result.Skipped++
+		return nil
+	}
+
+	if err := b.Put(key, value); err != nil {
+		return err
+	}
+
+	result.Imported++
+	return nil
+}
+
+func (line *jsonLine) item(b *BaseBucket) ([]byte, []byte, error) {
+	key, err := decodeBytes(*line.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if b.ValueMode() != ValueModeRaw {
+		return key, line.Value, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(line.Value, &s); err != nil {
+		return nil, nil, fmt.Errorf("the value must be a string in the raw mode")
+	}
+
+	value, err := decodeBytes(s)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, value, nil
+}
+
+// encodeBytes encodes the bytes to a string of JSON Lines.
+func encodeBytes(b []byte) string {
+	s := string(b)
+	if utf8.Valid(b) && !strings.HasPrefix(s, "0x") && strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsPrint(r)
+	}) < 0 {
+		return s
+	}
+
+	return "0x" + hex.EncodeToString(b)
+}
+
+// decodeBytes decodes the string of JSON Lines to the bytes.
+func decodeBytes(s string) ([]byte, error) {
+	if !strings.HasPrefix(s, "0x") {
+		return []byte(s), nil
+	}
+
+	b, err := hex.DecodeString(s[2:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex string %q: %v", s, err)
+	}
+
+	return b, nil
+}
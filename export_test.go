@@ -0,0 +1,158 @@
+package bucketstore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBucketExportAndImport(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	zoo := db.Bucket("zoo")
+	zoo.PutRaw([]byte("key1"), []byte(`{"name": "joe", "id": 12345678901234567890}`))
+	zoo.PutRaw([]byte{0x00, 0x01}, []byte(`{"name": "foo"}`))
+	zoo.PutRaw([]byte("0x12"), []byte(`{"name": "coo"}`))
+
+	var buf bytes.Buffer
+	n, err := zoo.Export(&buf)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("should be 3: %d", n)
+	}
+
+	expected := `{"key":"0x0001","value":{"name":"foo"}}
+{"key":"0x30783132","value":{"name":"coo"}}
+{"key":"key1","value":{"id":12345678901234567890,"name":"joe"}}
+`
+	if buf.String() != expected {
+		t.Errorf("unmatch: %s", buf.String())
+	}
+
+	farm := db.Bucket("farm")
+	farm.PutRaw([]byte("key1"), []byte(`{"name": "old"}`))
+
+	progress := []int{}
+	result, err := farm.Import(bytes.NewReader(buf.Bytes()), &ImportOptions{
+		Mode:      ImportModeSkipExisting,
+		BatchSize: 2,
+		Progress: func(result *ImportResult) {
+			progress = append(progress, result.Read)
+		},
+	})
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if result.Read != 3 || result.Imported != 2 || result.Skipped != 1 {
+		t.Errorf("unmatch: %v", result)
+	}
+	if len(progress) != 2 || progress[0] != 2 || progress[1] != 3 {
+		t.Errorf("unmatch: %v", progress)
+	}
+
+	if v, _ := farm.GetRaw([]byte("key1")); string(v) != `{"name":"old"}` {
+		t.Errorf("unmatch: %s", v)
+	}
+	if v, _ := farm.GetRaw([]byte{0x00, 0x01}); string(v) != `{"name":"foo"}` {
+		t.Errorf("unmatch: %s", v)
+	}
+	if v, _ := farm.GetRaw([]byte("0x12")); string(v) != `{"name":"coo"}` {
+		t.Errorf("unmatch: %s", v)
+	}
+
+	// upsert by default.
+	result, err = farm.Import(bytes.NewReader(buf.Bytes()), nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if result.Imported != 3 {
+		t.Errorf("should be 3: %d", result.Imported)
+	}
+	if v, _ := farm.GetRaw([]byte("key1")); string(v) != `{"id":12345678901234567890,"name":"joe"}` {
+		t.Errorf("unmatch: %s", v)
+	}
+
+	// the previous batches remain when it fails.
+	input := `{"key": "a", "value": {}}
+{"key": "b", "value": {}}
+{"key": "c", "value": []}
+`
+	result, err = db.Bucket("house").Import(strings.NewReader(input), &ImportOptions{BatchSize: 2})
+	if err == nil {
+		t.Errorf("should raise error")
+	}
+	if result.Imported != 2 {
+		t.Errorf("should be 2: %d", result.Imported)
+	}
+
+	if _, err := db.Bucket("house").Import(strings.NewReader(`{"value": {}}`), nil); err == nil {
+		t.Errorf("should raise error")
+	}
+	if _, err := db.Bucket("house").Import(strings.NewReader(`{"key": "", "value": {}}`), nil); err == nil {
+		t.Errorf("should raise error")
+	}
+	if _, err := db.Bucket("house").Import(strings.NewReader(`{"key": "0xzz", "value": {}}`), nil); err == nil {
+		t.Errorf("should raise error")
+	}
+}
+
+func TestBucketExportAndImportRawMode(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	files := db.Bucket("files")
+	files.SetValueMode(ValueModeRaw)
+	files.PutRaw([]byte("a.txt"), []byte("hello"))
+	files.PutRaw([]byte("b.bin"), []byte{0xff, 0x00})
+
+	var buf bytes.Buffer
+	if _, err := files.Export(&buf); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	expected := `{"key":"a.txt","value":"hello"}
+{"key":"b.bin","value":"0xff00"}
+`
+	if buf.String() != expected {
+		t.Errorf("unmatch: %s", buf.String())
+	}
+
+	copied := db.Bucket("copied")
+	copied.SetValueMode(ValueModeRaw)
+	if _, err := copied.Import(&buf, nil); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	if v, _ := copied.GetRaw([]byte("b.bin")); !bytes.Equal(v, []byte{0xff, 0x00}) {
+		t.Errorf("unmatch: %v", v)
+	}
+}
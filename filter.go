@@ -2,10 +2,15 @@ package bucketstore
 
 import (
 	"bytes"
+	"fmt"
+	"sort"
 )
 
 type Filter interface {
-	getItems(query *Query, bucket *BaseBucket) []*Item
+	forEach(query *Query, bucket *BaseBucket, fn func(*Item) error) error
+	// match checks whether the item matches the filter.
+	// It is used by the composite filters to check the items one by one.
+	match(bucket *BaseBucket, key []byte, value []byte) (bool, error)
 }
 
 type OrderBy int
@@ -19,11 +24,16 @@ type OrderByFilter struct {
 	OrderBy OrderBy
 }
 
-func (filter *OrderByFilter) getItems(query *Query, bucket *BaseBucket) (items []*Item) {
+func (filter *OrderByFilter) forEach(query *Query, bucket *BaseBucket, fn func(*Item) error) error {
 	c := bucket.Cursor()
 
 	var order = filter.OrderBy
 
+	after, err := query.afterPosition(positionTypeKey)
+	if err != nil {
+		return err
+	}
+
 	var offset = query.Offset
 	var limit = uint64(0)
 
@@ -33,36 +43,44 @@ func (filter *OrderByFilter) getItems(query *Query, bucket *BaseBucket) (items [
 
 	var counter uint64 = 0
 	if order == OrderByDesc {
-		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+		for k, v := beginCursor(c, after, order, c.Last); k != nil; k, v = c.Prev() {
 			if offset <= counter {
-				items = append(items, &Item{Key: k, Value: v})
+				if err := fn(&Item{Key: k, Value: v}); err != nil {
+					return err
+				}
 			}
 
 			counter++
 
 			if limit != 0 {
 				if limit <= counter {
-					return items
+					return nil
 				}
 			}
 		}
 	} else {
-		for k, v := c.First(); k != nil; k, v = c.Next() {
+		for k, v := beginCursor(c, after, order, c.First); k != nil; k, v = c.Next() {
 			if offset <= counter {
-				items = append(items, &Item{Key: k, Value: v})
+				if err := fn(&Item{Key: k, Value: v}); err != nil {
+					return err
+				}
 			}
 
 			counter++
 
 			if limit != 0 {
 				if limit <= counter {
-					return items
+					return nil
 				}
 			}
 		}
 	}
 
-	return items
+	return nil
+}
+
+func (filter *OrderByFilter) match(bucket *BaseBucket, key []byte, value []byte) (bool, error) {
+	return true, nil
 }
 
 type KeyPrefixFilter struct {
@@ -70,12 +88,17 @@ type KeyPrefixFilter struct {
 	OrderBy OrderBy
 }
 
-func (filter *KeyPrefixFilter) getItems(query *Query, bucket *BaseBucket) (items []*Item) {
+func (filter *KeyPrefixFilter) forEach(query *Query, bucket *BaseBucket, fn func(*Item) error) error {
 	c := bucket.Cursor()
 
 	var prefix = filter.Prefix
 	var order = filter.OrderBy
 
+	after, err := query.afterPosition(positionTypeKey)
+	if err != nil {
+		return err
+	}
+
 	var offset = query.Offset
 	var limit = uint64(0)
 
@@ -85,43 +108,58 @@ func (filter *KeyPrefixFilter) getItems(query *Query, bucket *BaseBucket) (items
 
 	var counter uint64 = 0
 	if order == OrderByDesc {
-		beginK, beginV := c.Seek(append(prefix, 0xFF))
-		if beginK == nil {
-			beginK, beginV = c.Last()
-		}
+		beginK, beginV := beginCursor(c, after, order, func() ([]byte, []byte) {
+			k, v := c.Seek(append(prefix, 0xFF))
+			if k == nil {
+				k, v = c.Last()
+			}
+			return k, v
+		})
 
 		for k, v := beginK, beginV; k != nil && bytes.HasPrefix(k, prefix); k, v = c.Prev() {
 			if offset <= counter {
-				items = append(items, &Item{Key: k, Value: v})
+				if err := fn(&Item{Key: k, Value: v}); err != nil {
+					return err
+				}
 			}
 
 			counter++
 
 			if limit != 0 {
 				if limit <= counter {
-					return items
+					return nil
 				}
 			}
 		}
 
 	} else {
-		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		beginK, beginV := beginCursor(c, after, order, func() ([]byte, []byte) {
+			return c.Seek(prefix)
+		})
+
+		for k, v := beginK, beginV; k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
 			if offset <= counter {
-				items = append(items, &Item{Key: k, Value: v})
+				if err := fn(&Item{Key: k, Value: v}); err != nil {
+					return err
+				}
 			}
 
 			counter++
 
 			if limit != 0 {
 				if limit <= counter {
-					return items
+					return nil
 				}
 			}
 		}
 
 	}
 
-	return items
+	return nil
+}
+
+func (filter *KeyPrefixFilter) match(bucket *BaseBucket, key []byte, value []byte) (bool, error) {
+	return bytes.HasPrefix(key, filter.Prefix), nil
 }
 
 type KeyRangeFilter struct {
@@ -130,13 +168,18 @@ type KeyRangeFilter struct {
 	OrderBy OrderBy
 }
 
-func (filter *KeyRangeFilter) getItems(query *Query, bucket *BaseBucket) (items []*Item) {
+func (filter *KeyRangeFilter) forEach(query *Query, bucket *BaseBucket, fn func(*Item) error) error {
 	c := bucket.Cursor()
 
 	var min = filter.Min
 	var max = filter.Max
 	var order = filter.OrderBy
 
+	after, err := query.afterPosition(positionTypeKey)
+	if err != nil {
+		return err
+	}
+
 	var offset = query.Offset
 	var limit = uint64(0)
 
@@ -146,43 +189,58 @@ func (filter *KeyRangeFilter) getItems(query *Query, bucket *BaseBucket) (items
 
 	var counter uint64 = 0
 	if order == OrderByDesc {
-		beginK, beginV := c.Seek(max)
-		if beginK == nil {
-			beginK, beginV = c.Last()
-		}
+		beginK, beginV := beginCursor(c, after, order, func() ([]byte, []byte) {
+			k, v := c.Seek(max)
+			if k == nil {
+				k, v = c.Last()
+			}
+			return k, v
+		})
 		for k, v := beginK, beginV; k != nil && bytes.Compare(k, min) >= 0; k, v = c.Prev() {
 			// seek may get a next value that is bigger than maxBytes so needs to check the value.
 			if bytes.Compare(k, max) <= 0 {
 				if offset <= counter {
-					items = append(items, &Item{Key: k, Value: v})
+					if err := fn(&Item{Key: k, Value: v}); err != nil {
+						return err
+					}
 				}
 
 				counter++
 
 				if limit != 0 {
 					if limit <= counter {
-						return items
+						return nil
 					}
 				}
 			}
 		}
 	} else {
-		for k, v := c.Seek(min); k != nil && bytes.Compare(k, max) <= 0; k, v = c.Next() {
+		beginK, beginV := beginCursor(c, after, order, func() ([]byte, []byte) {
+			return c.Seek(min)
+		})
+
+		for k, v := beginK, beginV; k != nil && bytes.Compare(k, max) <= 0; k, v = c.Next() {
 			if offset <= counter {
-				items = append(items, &Item{Key: k, Value: v})
+				if err := fn(&Item{Key: k, Value: v}); err != nil {
+					return err
+				}
 			}
 
 			counter++
 
 			if limit != 0 {
 				if limit <= counter {
-					return items
+					return nil
 				}
 			}
 		}
 	}
 
-	return items
+	return nil
+}
+
+func (filter *KeyRangeFilter) match(bucket *BaseBucket, key []byte, value []byte) (bool, error) {
+	return bytes.Compare(key, filter.Min) >= 0 && bytes.Compare(key, filter.Max) <= 0, nil
 }
 
 type PropValueMatchFilter struct {
@@ -191,12 +249,22 @@ type PropValueMatchFilter struct {
 	OrderBy  OrderBy
 }
 
-func (filter *PropValueMatchFilter) getItems(query *Query, bucket *BaseBucket) (items []*Item) {
+func (filter *PropValueMatchFilter) forEach(query *Query, bucket *BaseBucket, fn func(*Item) error) error {
 	ic := bucket.IndexCursor(filter.Property)
 
-	var match = filter.Match
+	// the strings are normalized by the collation of the index.
+	match, err := bucket.indexValue(filter.Property, filter.Match)
+	if err != nil {
+		return err
+	}
+
 	var order = filter.OrderBy
 
+	after, err := query.afterPosition(positionTypeIndex)
+	if err != nil {
+		return err
+	}
+
 	var offset = query.Offset
 	var limit = uint64(0)
 
@@ -214,38 +282,64 @@ func (filter *PropValueMatchFilter) getItems(query *Query, bucket *BaseBucket) (
 
 
 	if order == OrderByDesc {
-		for idx := ic.SeekLast(valueType, matchBytes); idx != nil && idx.ValueType() == valueType && bytes.Equal(idx.MustValueBytes(), matchBytes); idx = ic.Prev() {
+		begin := beginIndexCursor(ic, after, order, func() *Index {
+			return ic.SeekLast(valueType, matchBytes)
+		})
+
+		for idx := begin; idx != nil && idx.ValueType() == valueType && bytes.Equal(idx.MustValueBytes(), matchBytes); idx = ic.Prev() {
 			if offset <= counter {
-				k, v := idx.Data()
-				items = append(items, &Item{Key: k, Value: v})
+				if err := fn(indexItem(query, idx)); err != nil {
+					return err
+				}
 			}
 
 			counter++
 
 			if limit != 0 {
 				if limit <= counter {
-					return items
+					return nil
 				}
 			}
 		}
 	} else {
-		for idx := ic.SeekFirst(valueType, matchBytes); idx != nil && idx.ValueType() == valueType && bytes.Equal(idx.MustValueBytes(), matchBytes); idx = ic.Next() {
+		begin := beginIndexCursor(ic, after, order, func() *Index {
+			return ic.SeekFirst(valueType, matchBytes)
+		})
+
+		for idx := begin; idx != nil && idx.ValueType() == valueType && bytes.Equal(idx.MustValueBytes(), matchBytes); idx = ic.Next() {
 			if offset <= counter {
-				k, v := idx.Data()
-				items = append(items, &Item{Key: k, Value: v})
+				if err := fn(indexItem(query, idx)); err != nil {
+					return err
+				}
 			}
 
 			counter++
 
 			if limit != 0 {
 				if limit <= counter {
-					return items
+					return nil
 				}
 			}
 		}
 	}
 
-	return items
+	return nil
+}
+
+func (filter *PropValueMatchFilter) match(bucket *BaseBucket, key []byte, value []byte) (bool, error) {
+	match, err := bucket.indexValue(filter.Property, filter.Match)
+	if err != nil {
+		return false, err
+	}
+
+	matchBytes, valueType := toIndexedBytes(match)
+	if valueType == valueTypeNoIndex {
+		return false, nil
+	}
+
+	return matchIndexedValues(bucket, filter.Property, key, value, func(vt byte, vb []byte) bool {
+		return vt == valueType && bytes.Equal(vb, matchBytes)
+	})
 }
 
 type PropValuePrefixFilter struct {
@@ -254,12 +348,22 @@ type PropValuePrefixFilter struct {
 	OrderBy  OrderBy
 }
 
-func (filter *PropValuePrefixFilter) getItems(query *Query, bucket *BaseBucket) (items []*Item) {
+func (filter *PropValuePrefixFilter) forEach(query *Query, bucket *BaseBucket, fn func(*Item) error) error {
 	ic := bucket.IndexCursor(filter.Property)
 
-	var prefix = filter.Prefix
+	// the strings are normalized by the collation of the index.
+	prefix, err := bucket.indexValue(filter.Property, filter.Prefix)
+	if err != nil {
+		return err
+	}
+
 	var order = filter.OrderBy
 
+	after, err := query.afterPosition(positionTypeIndex)
+	if err != nil {
+		return err
+	}
+
 	var offset = query.Offset
 	var limit = uint64(0)
 
@@ -276,39 +380,78 @@ func (filter *PropValuePrefixFilter) getItems(query *Query, bucket *BaseBucket)
 	}
 
 
+	// matched checks whether a value of the array property matches the filter.
+	matched := func(vt byte, vb []byte) bool {
+		return vt == valueType && bytes.HasPrefix(vb, prefixBytes)
+	}
+
 	if order == OrderByDesc {
-		for idx := ic.SeekLast(valueType, prefixBytes); idx != nil && idx.ValueType() == valueType && bytes.HasPrefix(idx.MustValueBytes(), prefixBytes); idx = ic.Prev() {
+		begin := beginIndexCursor(ic, after, order, func() *Index {
+			return ic.SeekLast(valueType, prefixBytes)
+		})
+
+		for idx := begin; idx != nil && idx.ValueType() == valueType && bytes.HasPrefix(idx.MustValueBytes(), prefixBytes); idx = ic.Prev() {
+			if foundBefore(idx, order, matched) {
+				continue
+			}
+
 			if offset <= counter {
-				k, v := idx.Data()
-				items = append(items, &Item{Key: k, Value: v})
+				if err := fn(indexItem(query, idx)); err != nil {
+					return err
+				}
 			}
 
 			counter++
 
 			if limit != 0 {
 				if limit <= counter {
-					return items
+					return nil
 				}
 			}
 		}
 	} else {
-		for idx := ic.SeekFirst(valueType, prefixBytes); idx != nil && idx.ValueType() == valueType && bytes.HasPrefix(idx.MustValueBytes(), prefixBytes); idx = ic.Next() {
+		begin := beginIndexCursor(ic, after, order, func() *Index {
+			return ic.SeekFirst(valueType, prefixBytes)
+		})
+
+		for idx := begin; idx != nil && idx.ValueType() == valueType && bytes.HasPrefix(idx.MustValueBytes(), prefixBytes); idx = ic.Next() {
+			if foundBefore(idx, order, matched) {
+				continue
+			}
+
 			if offset <= counter {
-				k, v := idx.Data()
-				items = append(items, &Item{Key: k, Value: v})
+				if err := fn(indexItem(query, idx)); err != nil {
+					return err
+				}
 			}
 
 			counter++
 
 			if limit != 0 {
 				if limit <= counter {
-					return items
+					return nil
 				}
 			}
 		}
 	}
 
-	return items
+	return nil
+}
+
+func (filter *PropValuePrefixFilter) match(bucket *BaseBucket, key []byte, value []byte) (bool, error) {
+	prefix, err := bucket.indexValue(filter.Property, filter.Prefix)
+	if err != nil {
+		return false, err
+	}
+
+	prefixBytes, valueType := toIndexedBytes(prefix)
+	if valueType == valueTypeNoIndex {
+		return false, nil
+	}
+
+	return matchIndexedValues(bucket, filter.Property, key, value, func(vt byte, vb []byte) bool {
+		return vt == valueType && bytes.HasPrefix(vb, prefixBytes)
+	})
 }
 
 type PropValueRangeFilter struct {
@@ -318,13 +461,27 @@ type PropValueRangeFilter struct {
 	OrderBy  OrderBy
 }
 
-func (filter *PropValueRangeFilter) getItems(query *Query, bucket *BaseBucket) (items []*Item) {
+func (filter *PropValueRangeFilter) forEach(query *Query, bucket *BaseBucket, fn func(*Item) error) error {
 	ic := bucket.IndexCursor(filter.Property)
 
-	var min = filter.Min
-	var max = filter.Max
+	// the strings are normalized by the collation of the index.
+	min, err := bucket.indexValue(filter.Property, filter.Min)
+	if err != nil {
+		return err
+	}
+
+	max, err := bucket.indexValue(filter.Property, filter.Max)
+	if err != nil {
+		return err
+	}
+
 	var order = filter.OrderBy
 
+	after, err := query.afterPosition(positionTypeIndex)
+	if err != nil {
+		return err
+	}
+
 	var offset = query.Offset
 	var limit = uint64(0)
 
@@ -347,37 +504,820 @@ func (filter *PropValueRangeFilter) getItems(query *Query, bucket *BaseBucket) (
 		return nil
 	}
 
+	// matched checks whether a value of the array property matches the filter.
+	matched := func(vt byte, vb []byte) bool {
+		return vt == valueType && bytes.Compare(vb, minBytes) >= 0 && bytes.Compare(vb, maxBytes) <= 0
+	}
+
 	if order == OrderByDesc {
-		for idx := ic.SeekLast(valueType, maxBytes); idx != nil && idx.ValueType() == valueType && bytes.Compare(idx.MustValueBytes(), minBytes) >= 0; idx = ic.Prev() {
+		begin := beginIndexCursor(ic, after, order, func() *Index {
+			return ic.SeekLast(valueType, maxBytes)
+		})
+
+		for idx := begin; idx != nil && idx.ValueType() == valueType && bytes.Compare(idx.MustValueBytes(), minBytes) >= 0; idx = ic.Prev() {
+			if foundBefore(idx, order, matched) {
+				continue
+			}
+
 			if offset <= counter {
-				k, v := idx.Data()
-				items = append(items, &Item{Key: k, Value: v})
+				if err := fn(indexItem(query, idx)); err != nil {
+					return err
+				}
 			}
 
 			counter++
 
 			if limit != 0 {
 				if limit <= counter {
-					return items
+					return nil
 				}
 			}
 		}
 	} else {
-		for idx := ic.SeekFirst(valueType, minBytes); idx != nil && idx.ValueType() == valueType && bytes.Compare(idx.MustValueBytes(), maxBytes) <= 0; idx = ic.Next() {
+		begin := beginIndexCursor(ic, after, order, func() *Index {
+			return ic.SeekFirst(valueType, minBytes)
+		})
+
+		for idx := begin; idx != nil && idx.ValueType() == valueType && bytes.Compare(idx.MustValueBytes(), maxBytes) <= 0; idx = ic.Next() {
+			if foundBefore(idx, order, matched) {
+				continue
+			}
+
 			if offset <= counter {
-				k, v := idx.Data()
-				items = append(items, &Item{Key: k, Value: v})
+				if err := fn(indexItem(query, idx)); err != nil {
+					return err
+				}
 			}
 
 			counter++
 
 			if limit != 0 {
 				if limit <= counter {
-					return items
+					return nil
 				}
 			}
 		}
 	}
 
+	return nil
+}
+
+func (filter *PropValueRangeFilter) match(bucket *BaseBucket, key []byte, value []byte) (bool, error) {
+	min, err := bucket.indexValue(filter.Property, filter.Min)
+	if err != nil {
+		return false, err
+	}
+
+	max, err := bucket.indexValue(filter.Property, filter.Max)
+	if err != nil {
+		return false, err
+	}
+
+	minBytes, valueType := toIndexedBytes(min)
+	maxBytes, valueType2 := toIndexedBytes(max)
+	if valueType == valueTypeNoIndex || valueType != valueType2 {
+		return false, nil
+	}
+
+	return matchIndexedValues(bucket, filter.Property, key, value, func(vt byte, vb []byte) bool {
+		return vt == valueType && bytes.Compare(vb, minBytes) >= 0 && bytes.Compare(vb, maxBytes) <= 0
+	})
+}
+
+// CompoundIndexFilter selects items by the compound index over the properties.
+// Match is the values of the leading properties to match exactly.
+// Min and Max are the range of the next property. If they are nil, the range is not limited on the side.
+// The items that have multiple values of any of the properties by an array are not indexed, so they are never selected.
+// The results are ordered by the compound index.
+type CompoundIndexFilter struct {
+	Properties []string
+	Match      []interface{}
+	Min        interface{}
+	Max        interface{}
+	OrderBy    OrderBy
+}
+
+func (filter *CompoundIndexFilter) forEach(query *Query, bucket *BaseBucket, fn func(*Item) error) error {
+	config, err := bucket.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	bounds, err := filter.bounds(config)
+	if err != nil {
+		return err
+	}
+
+	if bounds == nil {
+		// does not index.
+		return nil
+	}
+
+	indexBucket := bucket.getCompoundIndexBucket(filter.Properties)
+	if indexBucket == nil {
+		// does not index.
+		return nil
+	}
+
+	c := indexBucket.Cursor()
+
+	var order = filter.OrderBy
+
+	after, err := query.afterPosition(positionTypeIndex)
+	if err != nil {
+		return err
+	}
+
+	var offset = query.Offset
+	var limit = uint64(0)
+
+	if query.Limit != 0 {
+		limit = offset + query.Limit
+	}
+
+	var counter uint64 = 0
+
+	prefix := bounds.prefix
+	valueType := bounds.valueType
+
+	if order == OrderByDesc {
+		beginK, beginV := beginCursor(c, after, order, func() ([]byte, []byte) {
+			var seek []byte
+			if bounds.hasMax {
+				seek = append(append([]byte{}, prefix...), genIndexPrefixForSeekLast(valueType, bounds.maxBytes)...)
+			} else if bounds.hasMin {
+				seek = append(append([]byte{}, prefix...), valueType+1)
+			} else {
+				seek = append(append([]byte{}, prefix...), 0xFF)
+			}
+
+			if k, _ := c.Seek(seek); k == nil {
+				return c.Last()
+			}
+			return c.Prev()
+		})
+
+		for k, v := beginK, beginV; k != nil && bounds.inIndex(k); k, v = c.Prev() {
+			cmp := bounds.compare(k)
+			if cmp < 0 {
+				break
+			}
+			if cmp > 0 {
+				continue
+			}
+
+			if offset <= counter {
+				if err := fn(indexItem(query, newIndex(bucket, k, v))); err != nil {
+					return err
+				}
+			}
+
+			counter++
+
+			if limit != 0 {
+				if limit <= counter {
+					return nil
+				}
+			}
+		}
+	} else {
+		beginK, beginV := beginCursor(c, after, order, func() ([]byte, []byte) {
+			if bounds.hasMin {
+				return c.Seek(append(append([]byte{}, prefix...), genIndexPrefixForSeekFirst(valueType, bounds.minBytes)...))
+			} else if bounds.hasMax {
+				return c.Seek(append(append([]byte{}, prefix...), valueType))
+			}
+			return c.Seek(prefix)
+		})
+
+		for k, v := beginK, beginV; k != nil && bounds.inIndex(k); k, v = c.Next() {
+			cmp := bounds.compare(k)
+			if cmp > 0 {
+				break
+			}
+			if cmp < 0 {
+				continue
+			}
+
+			if offset <= counter {
+				if err := fn(indexItem(query, newIndex(bucket, k, v))); err != nil {
+					return err
+				}
+			}
+
+			counter++
+
+			if limit != 0 {
+				if limit <= counter {
+					return nil
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (filter *CompoundIndexFilter) match(bucket *BaseBucket, key []byte, value []byte) (bool, error) {
+	config, err := bucket.IndexConfig()
+	if err != nil {
+		return false, err
+	}
+
+	bounds, err := filter.bounds(config)
+	if err != nil || bounds == nil {
+		return false, err
+	}
+
+	indexBucket := bucket.getCompoundIndexBucket(filter.Properties)
+	if indexBucket == nil {
+		return false, nil
+	}
+
+	var jsonMap map[string]interface{}
+	if err := decodeJSON(value, &jsonMap); err != nil {
+		// not a json object, so it is not indexed.
+		return false, nil
+	}
+
+	indexKey := genCompoundIndexKey(config, filter.Properties, flattenProperties(jsonMap), key)
+	if indexKey == nil || indexBucket.Get(indexKey) == nil {
+		return false, nil
+	}
+
+	return bounds.inIndex(indexKey) && bounds.compare(indexKey) == 0, nil
+}
+
+// bounds gets the range of the compound index keys selected by the filter.
+// The values are converted in the same way as the index by the configuration.
+// It returns nil if the values are not indexed.
+func (filter *CompoundIndexFilter) bounds(config *IndexConfig) (*compoundIndexBounds, error) {
+	hasRange := filter.Min != nil || filter.Max != nil
+
+	if len(filter.Match) > len(filter.Properties) || (hasRange && len(filter.Match) >= len(filter.Properties)) {
+		return nil, fmt.Errorf("the compound index filter has more values than the properties")
+	}
+
+	prefix := genCompoundIndexPrefix(config, filter.Properties, filter.Match)
+	if prefix == nil {
+		return nil, nil
+	}
+
+	bounds := &compoundIndexBounds{
+		prefix: prefix,
+		hasMin: filter.Min != nil,
+		hasMax: filter.Max != nil,
+	}
+
+	// the range is of the property next to the matched properties.
+	var rangeProp string
+	if hasRange {
+		rangeProp = filter.Properties[len(filter.Match)]
+	}
+
+	if bounds.hasMin {
+		bounds.minBytes, bounds.valueType = toIndexedBytes(config.indexValue(rangeProp, filter.Min))
+	}
+	if bounds.hasMax {
+		var valueType byte
+		bounds.maxBytes, valueType = toIndexedBytes(config.indexValue(rangeProp, filter.Max))
+		if bounds.hasMin && bounds.valueType != valueType {
+			// unsupport difference value type range
+			return nil, nil
+		}
+		bounds.valueType = valueType
+	}
+	if hasRange && bounds.valueType == valueTypeNoIndex {
+		return nil, nil
+	}
+
+	return bounds, nil
+}
+
+// compoundIndexBounds is the range of the compound index keys.
+// The keys have the prefix of the matched values, and the value of the next property is in the range.
+type compoundIndexBounds struct {
+	prefix    []byte
+	hasMin    bool
+	hasMax    bool
+	valueType byte
+	minBytes  []byte
+	maxBytes  []byte
+}
+
+// compare compares the value of the range property of the key with the range.
+// It returns -1 if it is less than min, 1 if it is greater than max, and 0 if it is in the range.
+func (bounds *compoundIndexBounds) compare(k []byte) int {
+	if !bounds.hasMin && !bounds.hasMax {
+		return 0
+	}
+
+	vb, err := getValueFromIndexKey(k[len(bounds.prefix):])
+	if err != nil {
+		return 1
+	}
+
+	if bounds.hasMin && bytes.Compare(vb, bounds.minBytes) < 0 {
+		return -1
+	}
+	if bounds.hasMax && bytes.Compare(vb, bounds.maxBytes) > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// inIndex checks whether the key has the prefix and the value type of the range property.
+func (bounds *compoundIndexBounds) inIndex(k []byte) bool {
+	if !bytes.HasPrefix(k, bounds.prefix) {
+		return false
+	}
+
+	hasRange := bounds.hasMin || bounds.hasMax
+	return !hasRange || (len(k) > len(bounds.prefix) && k[len(bounds.prefix)] == bounds.valueType)
+}
+
+// AndFilter selects items that match all of the filters.
+// The results are ordered by the item key.
+// It walks the first filter that finds the items in the key order (PropValueMatchFilter, KeyPrefixFilter or KeyRangeFilter),
+// and checks the found items by the other filters one by one.
+// If there is no such filter, it collects the keys found by the first filter that uses an index, and checks them in the key order.
+// If none of the filters use an index, it reads all items of the bucket.
+// So put the filter that selects the fewest items first.
+type AndFilter struct {
+	Filters []Filter
+	OrderBy OrderBy
+}
+
+func (filter *AndFilter) forEach(query *Query, bucket *BaseBucket, fn func(*Item) error) error {
+	if len(filter.Filters) == 0 {
+		return nil
+	}
+
+	for i, f := range filter.Filters {
+		if ordered := keyOrderedFilter(f, filter.OrderBy); ordered != nil {
+			return forEachCheckedItem(query, bucket, ordered, filtersWithout(filter.Filters, i), fn)
+		}
+	}
+
+	for i, f := range filter.Filters {
+		if isIndexedFilter(f) {
+			keys, err := collectKeys(bucket, []Filter{f}, filter.OrderBy)
+			if err != nil {
+				return err
+			}
+
+			return forEachKey(query, bucket, keys, filtersWithout(filter.Filters, i), filter.OrderBy, fn)
+		}
+	}
+
+	return forEachMatchedItem(query, bucket, filter, filter.OrderBy, fn)
+}
+
+func (filter *AndFilter) match(bucket *BaseBucket, key []byte, value []byte) (bool, error) {
+	if len(filter.Filters) == 0 {
+		return false, nil
+	}
+
+	return matchAll(filter.Filters, bucket, key, value)
+}
+
+// OrFilter selects items that match any of the filters.
+// The results are ordered by the item key.
+// It collects the keys found by the filters and merges them in the key order, so it holds the keys in memory.
+// If any of the filters doesn't use an index like NotFilter, it reads all items of the bucket instead.
+type OrFilter struct {
+	Filters []Filter
+	OrderBy OrderBy
+}
+
+func (filter *OrFilter) forEach(query *Query, bucket *BaseBucket, fn func(*Item) error) error {
+	if !isIndexedFilter(filter) {
+		return forEachMatchedItem(query, bucket, filter, filter.OrderBy, fn)
+	}
+
+	keys, err := collectKeys(bucket, filter.Filters, filter.OrderBy)
+	if err != nil {
+		return err
+	}
+
+	return forEachKey(query, bucket, keys, nil, filter.OrderBy, fn)
+}
+
+func (filter *OrFilter) match(bucket *BaseBucket, key []byte, value []byte) (bool, error) {
+	for _, f := range filter.Filters {
+		matched, err := f.match(bucket, key, value)
+		if err != nil || matched {
+			return matched, err
+		}
+	}
+
+	return false, nil
+}
+
+// NotFilter selects items that don't match the filter.
+// The results are ordered by the item key.
+// It reads all items of the bucket and checks them by the filter.
+type NotFilter struct {
+	Filter  Filter
+	OrderBy OrderBy
+}
+
+func (filter *NotFilter) forEach(query *Query, bucket *BaseBucket, fn func(*Item) error) error {
+	return forEachMatchedItem(query, bucket, filter, filter.OrderBy, fn)
+}
+
+func (filter *NotFilter) match(bucket *BaseBucket, key []byte, value []byte) (bool, error) {
+	matched, err := filter.Filter.match(bucket, key, value)
+	return !matched, err
+}
+
+// isIndexedFilter checks whether the filter finds the items by an index or a range of the keys
+// without reading all items of the bucket.
+func isIndexedFilter(filter Filter) bool {
+	switch f := filter.(type) {
+	case *OrderByFilter, *NotFilter:
+		return false
+	case *AndFilter:
+		for _, child := range f.Filters {
+			if isIndexedFilter(child) {
+				return true
+			}
+		}
+		return false
+	case *OrFilter:
+		for _, child := range f.Filters {
+			if !isIndexedFilter(child) {
+				return false
+			}
+		}
+		return len(f.Filters) > 0
+	}
+
+	return true
+}
+
+// readsIndex checks whether the filter reads the indexes of the bucket to find the items.
+func readsIndex(filter Filter) bool {
+	var children []Filter
+	switch f := filter.(type) {
+	case *OrderByFilter, *KeyPrefixFilter, *KeyRangeFilter, *NotFilter:
+		return false
+	case *AndFilter:
+		children = f.Filters
+	case *OrFilter:
+		children = f.Filters
+	default:
+		return true
+	}
+
+	if !isIndexedFilter(filter) {
+		// it scans all items.
+		return false
+	}
+
+	for _, child := range children {
+		if readsIndex(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyOrderedFilter gets a copy of the filter that finds the items in the key order of the order.
+// The index of PropValueMatchFilter has the same value, so it is walked in the key order.
+// It returns nil if the filter doesn't find the items in the key order.
+func keyOrderedFilter(filter Filter, order OrderBy) Filter {
+	switch f := filter.(type) {
+	case *KeyPrefixFilter:
+		ordered := *f
+		ordered.OrderBy = order
+		return &ordered
+	case *KeyRangeFilter:
+		ordered := *f
+		ordered.OrderBy = order
+		return &ordered
+	case *PropValueMatchFilter:
+		ordered := *f
+		ordered.OrderBy = order
+		return &ordered
+	}
+
+	return nil
+}
+
+func filtersWithout(filters []Filter, i int) []Filter {
+	return append(append([]Filter{}, filters[:i]...), filters[i+1:]...)
+}
+
+func matchAll(filters []Filter, bucket *BaseBucket, key []byte, value []byte) (bool, error) {
+	for _, f := range filters {
+		matched, err := f.match(bucket, key, value)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// forEachCheckedItem walks the items found by the filter and calls the function for the items that match all of the checks.
+// The position to resume is the position of the filter.
+func forEachCheckedItem(query *Query, bucket *BaseBucket, filter Filter, checks []Filter, fn func(*Item) error) error {
+	// the checks need the values.
+	fq := &Query{after: query.after, keysOnly: query.keysOnly && len(checks) == 0}
+
+	var offset = query.Offset
+	var limit = uint64(0)
+
+	if query.Limit != 0 {
+		limit = offset + query.Limit
+	}
+
+	var counter uint64 = 0
+
+	err := filter.forEach(fq, bucket, func(item *Item) error {
+		matched, err := matchAll(checks, bucket, item.Key, item.Value)
+		if err != nil {
+			return err
+		}
+
+		if !matched {
+			return nil
+		}
+
+		if offset <= counter {
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+
+		counter++
+
+		if limit != 0 {
+			if limit <= counter {
+				return errStopIteration
+			}
+		}
+
+		return nil
+	})
+	if err == errStopIteration {
+		err = nil
+	}
+
+	return err
+}
+
+// collectKeys collects the keys of the items found by any of the filters without getting the values.
+// The keys are sorted in the order without duplicates.
+func collectKeys(bucket *BaseBucket, filters []Filter, order OrderBy) ([][]byte, error) {
+	keys := [][]byte{}
+	for _, f := range filters {
+		err := f.forEach(&Query{keysOnly: true}, bucket, func(item *Item) error {
+			keys = append(keys, item.Key)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// remove the keys found by multiple filters.
+	return sortKeys(keys, order), nil
+}
+
+// sortKeys sorts the keys in the order and removes the duplicated keys.
+func sortKeys(keys [][]byte, order OrderBy) [][]byte {
+	sort.Sort(&sortableKeys{keys: keys, order: order})
+
+	sorted := keys[:0]
+	for i, k := range keys {
+		if i > 0 && bytes.Equal(k, keys[i-1]) {
+			continue
+		}
+		sorted = append(sorted, k)
+	}
+
+	return sorted
+}
+
+type sortableKeys struct {
+	keys  [][]byte
+	order OrderBy
+}
+
+func (s *sortableKeys) Len() int      { return len(s.keys) }
+func (s *sortableKeys) Swap(i, j int) { s.keys[i], s.keys[j] = s.keys[j], s.keys[i] }
+func (s *sortableKeys) Less(i, j int) bool {
+	if s.order == OrderByDesc {
+		return bytes.Compare(s.keys[i], s.keys[j]) > 0
+	}
+	return bytes.Compare(s.keys[i], s.keys[j]) < 0
+}
+
+// forEachKey walks the items of the sorted keys and calls the function for the items that match all of the checks.
+func forEachKey(query *Query, bucket *BaseBucket, keys [][]byte, checks []Filter, order OrderBy, fn func(*Item) error) error {
+	after, err := query.afterPosition(positionTypeKey)
+	if err != nil {
+		return err
+	}
+
+	if after != nil {
+		// skip the keys until the position.
+		keys = keys[sort.Search(len(keys), func(i int) bool {
+			if order == OrderByDesc {
+				return bytes.Compare(keys[i], after) < 0
+			}
+			return bytes.Compare(keys[i], after) > 0
+		}):]
+	}
+
+	var offset = query.Offset
+	var limit = uint64(0)
+
+	if query.Limit != 0 {
+		limit = offset + query.Limit
+	}
+
+	var counter uint64 = 0
+
+	for _, k := range keys {
+		var v []byte
+		if len(checks) > 0 || !query.keysOnly {
+			v = bucket.data.Get(k)
+		}
+
+		matched, err := matchAll(checks, bucket, k, v)
+		if err != nil {
+			return err
+		}
+
+		if !matched {
+			continue
+		}
+
+		if offset <= counter {
+			if err := fn(&Item{Key: k, Value: v}); err != nil {
+				return err
+			}
+		}
+
+		counter++
+
+		if limit != 0 {
+			if limit <= counter {
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+// forEachMatchedItem walks the items in the key order and calls the function for the items that match the filter.
+func forEachMatchedItem(query *Query, bucket *BaseBucket, filter Filter, order OrderBy, fn func(*Item) error) error {
+	c := bucket.Cursor()
+
+	after, err := query.afterPosition(positionTypeKey)
+	if err != nil {
+		return err
+	}
+
+	var offset = query.Offset
+	var limit = uint64(0)
+
+	if query.Limit != 0 {
+		limit = offset + query.Limit
+	}
+
+	var counter uint64 = 0
+
+	if order == OrderByDesc {
+		for k, v := beginCursor(c, after, order, c.Last); k != nil; k, v = c.Prev() {
+			matched, err := filter.match(bucket, k, v)
+			if err != nil {
+				return err
+			}
+
+			if !matched {
+				continue
+			}
+
+			if offset <= counter {
+				if err := fn(&Item{Key: k, Value: v}); err != nil {
+					return err
+				}
+			}
+
+			counter++
+
+			if limit != 0 {
+				if limit <= counter {
+					return nil
+				}
+			}
+		}
+	} else {
+		for k, v := beginCursor(c, after, order, c.First); k != nil; k, v = c.Next() {
+			matched, err := filter.match(bucket, k, v)
+			if err != nil {
+				return err
+			}
+
+			if !matched {
+				continue
+			}
+
+			if offset <= counter {
+				if err := fn(&Item{Key: k, Value: v}); err != nil {
+					return err
+				}
+			}
+
+			counter++
+
+			if limit != 0 {
+				if limit <= counter {
+					return nil
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// matchIndexedValues checks whether any value of the property of the item matches
+// in the same way as the filters walk the index of the property.
+func matchIndexedValues(bucket *BaseBucket, propName string, key []byte, value []byte, matched func(valueType byte, value []byte) bool) (bool, error) {
+	indexBucket := bucket.getIndexBucket(propName)
+	if indexBucket == nil {
+		return false, nil
+	}
+
+	config, err := bucket.IndexConfig()
+	if err != nil {
+		return false, err
+	}
+
+	var jsonMap map[string]interface{}
+	if err := decodeJSON(value, &jsonMap); err != nil {
+		// not a json object, so it is not indexed.
+		return false, nil
+	}
+
+	for _, v := range flattenProperties(jsonMap)[propName] {
+		indexKey := genIndexKey(config.indexValue(propName, v), key)
+		if indexKey == nil || indexBucket.Get(indexKey) == nil {
+			continue
+		}
+
+		valueBytes, err := getValueFromIndexKey(indexKey)
+		if err != nil {
+			continue
+		}
+
+		if matched(indexKey[0], valueBytes) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// indexItem gets the item that the index refers.
+// If the query needs only keys, it doesn't get the value.
+func indexItem(query *Query, idx *Index) *Item {
+	if query.keysOnly {
+		return &Item{Key: idx.Key(), position: indexPosition(idx.key)}
+	}
+
+	k, v := idx.Data()
+	return &Item{Key: k, Value: v, position: indexPosition(idx.key)}
+}
+
+func eachItem(items []*Item, fn func(*Item) error) error {
+	for _, item := range items {
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// limitItems applies offset and limit of the query to the items.
+func limitItems(query *Query, items []*Item) []*Item {
+	if query.Offset >= uint64(len(items)) {
+		return nil
+	}
+
+	items = items[query.Offset:]
+
+	if query.Limit != 0 && query.Limit < uint64(len(items)) {
+		items = items[:query.Limit]
+	}
+
 	return items
 }
@@ -5,6 +5,7 @@ import (
 	"os"
 	"testing"
 	"fmt"
+	"math"
 )
 
 func TestFilterOrderFilter(t *testing.T) {
@@ -371,3 +372,461 @@ func TestFilterPropertyValueMatchFilter(t *testing.T) {
 
 
 
+
+func TestFilterPropertyValueRangeFilterNegativeNumbers(t *testing.T) {
+	// setup database
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	ds, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer ds.Close()
+
+	bucket := ds.Bucket("test_bucket")
+	bucket.PutRaw([]byte("key1"), []byte(`{"num": -100}`))
+	bucket.PutRaw([]byte("key2"), []byte(`{"num": -10}`))
+	bucket.PutRaw([]byte("key3"), []byte(`{"num": -2.5}`))
+	bucket.PutRaw([]byte("key4"), []byte(`{"num": -0}`))
+	bucket.PutRaw([]byte("key5"), []byte(`{"num": 0}`))
+	bucket.PutRaw([]byte("key6"), []byte(`{"num": 3}`))
+	bucket.PutRaw([]byte("key7"), []byte(`{"num": 10}`))
+	bucket.PutRaw([]byte("key8"), []byte(`{"num": 100}`))
+
+	// asc
+	q := bucket.Query()
+	q.Filter = &PropValueRangeFilter{
+		Property: "num",
+		Min:      -10,
+		Max:      10,
+	}
+
+	items, err := q.AsList()
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	expected := []string{"key2", "key3", "key4", "key5", "key6", "key7"}
+	if len(items) != len(expected) {
+		t.Fatalf("invalid count: %d", len(items))
+	}
+	for i, item := range items {
+		if string(item.Key) != expected[i] {
+			t.Errorf("unmatch: %s", string(item.Key))
+		}
+	}
+
+	// desc
+	q = bucket.Query()
+	q.Filter = &PropValueRangeFilter{
+		Property: "num",
+		Min:      -10,
+		Max:      10,
+		OrderBy:  OrderByDesc,
+	}
+
+	items, err = q.AsList()
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	expected = []string{"key7", "key6", "key5", "key4", "key3", "key2"}
+	if len(items) != len(expected) {
+		t.Fatalf("invalid count: %d", len(items))
+	}
+	for i, item := range items {
+		if string(item.Key) != expected[i] {
+			t.Errorf("unmatch: %s", string(item.Key))
+		}
+	}
+
+	// infinity
+	q = bucket.Query()
+	q.Filter = &PropValueRangeFilter{
+		Property: "num",
+		Min:      math.Inf(-1),
+		Max:      math.Inf(1),
+	}
+
+	items, err = q.AsList()
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	if len(items) != 8 {
+		t.Errorf("invalid count: %d", len(items))
+	}
+
+	// match -0
+	q = bucket.Query()
+	q.Filter = &PropValueMatchFilter{
+		Property: "num",
+		Match:    math.Copysign(0, -1),
+	}
+
+	items, err = q.AsList()
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	if len(items) != 2 {
+		t.Errorf("invalid count: %d", len(items))
+	}
+}
+
+func TestFilterNestedProperty(t *testing.T) {
+	// setup database
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	ds, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer ds.Close()
+
+	bucket := ds.Bucket("test_bucket")
+	bucket.PutRaw([]byte("key1"), []byte(`{"address": {"city": "Tokyo", "zip": 100}}`))
+	bucket.PutRaw([]byte("key2"), []byte(`{"address": {"city": "Osaka", "zip": 530}}`))
+	bucket.PutRaw([]byte("key3"), []byte(`{"address": {"city": "Tokushima", "zip": 770}}`))
+
+	q := bucket.Query()
+	q.Filter = &PropValueMatchFilter{
+		Property: "address.city",
+		Match:    "Tokyo",
+	}
+
+	items, err := q.AsList()
+	if len(items) != 1 || string(items[0].Key) != "key1" {
+		t.Errorf("unmatch: %v", items)
+	}
+
+	q = bucket.Query()
+	q.Filter = &PropValuePrefixFilter{
+		Property: "address.city",
+		Prefix:   "Toku",
+	}
+
+	items, err = q.AsList()
+	if len(items) != 1 || string(items[0].Key) != "key3" {
+		t.Errorf("unmatch: %v", items)
+	}
+
+	q = bucket.Query()
+	q.Filter = &PropValueRangeFilter{
+		Property: "address.zip",
+		Min:      100,
+		Max:      600,
+		OrderBy:  OrderByDesc,
+	}
+
+	items, err = q.AsList()
+	if len(items) != 2 || string(items[0].Key) != "key2" {
+		t.Errorf("unmatch: %v", items)
+	}
+}
+
+func TestFilterArrayProperty(t *testing.T) {
+	// setup database
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	ds, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer ds.Close()
+
+	bucket := ds.Bucket("test_bucket")
+	bucket.PutRaw([]byte("key1"), []byte(`{"tags": ["go", "db", "go"], "scores": [3, 5, 8]}`))
+	bucket.PutRaw([]byte("key2"), []byte(`{"tags": ["rust"], "scores": [1, 20]}`))
+	bucket.PutRaw([]byte("key3"), []byte(`{"tags": ["go"], "scores": [4]}`))
+
+	q := bucket.Query()
+	q.Filter = &PropValueMatchFilter{
+		Property: "tags",
+		Match:    "go",
+	}
+
+	items, err := q.AsList()
+	if len(items) != 2 || string(items[0].Key) != "key1" || string(items[1].Key) != "key3" {
+		t.Errorf("unmatch: %v", items)
+	}
+
+	// the item that has some values in the range is found only once.
+	q = bucket.Query()
+	q.Filter = &PropValueRangeFilter{
+		Property: "scores",
+		Min:      2,
+		Max:      10,
+	}
+
+	items, err = q.AsList()
+	if len(items) != 2 || string(items[0].Key) != "key1" || string(items[1].Key) != "key3" {
+		t.Errorf("unmatch: %v", items)
+	}
+
+	// in the descending order, the item is found at the greatest value in the range.
+	q = bucket.Query()
+	q.Filter = &PropValueRangeFilter{
+		Property: "scores",
+		Min:      2,
+		Max:      10,
+		OrderBy:  OrderByDesc,
+	}
+
+	items, err = q.AsList()
+	if len(items) != 2 || string(items[0].Key) != "key1" || string(items[1].Key) != "key3" {
+		t.Errorf("unmatch: %v", items)
+	}
+
+	// the offset doesn't count the duplicated values.
+	q = bucket.Query()
+	q.Filter = &PropValuePrefixFilter{
+		Property: "tags",
+		Prefix:   "",
+	}
+	q.Offset = 1
+
+	items, err = q.AsList()
+	if len(items) != 2 || string(items[0].Key) != "key3" || string(items[1].Key) != "key2" {
+		t.Errorf("unmatch: %v", items)
+	}
+
+	// update removes stale element index.
+	bucket.PutRaw([]byte("key1"), []byte(`{"tags": ["db"]}`))
+
+	q = bucket.Query()
+	q.Filter = &PropValueMatchFilter{
+		Property: "tags",
+		Match:    "go",
+	}
+
+	items, err = q.AsList()
+	if len(items) != 1 || string(items[0].Key) != "key3" {
+		t.Errorf("unmatch: %v", items)
+	}
+
+	// delete removes element index.
+	bucket.Delete([]byte("key3"))
+
+	items, err = q.AsList()
+	if len(items) != 0 {
+		t.Errorf("unmatch: %v", items)
+	}
+
+	// the duplicated values are found by the index without reading the items.
+	bucket.PutRaw([]byte("key4"), []byte(`{"scores": [3, 5, 8]}`))
+	err = ds.Update(func(tx *Tx) error {
+		return tx.bData().Bucket([]byte("test_bucket")).Put([]byte("key4"), []byte(`{}`))
+	})
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	q = bucket.Query()
+	q.Filter = &PropValueRangeFilter{
+		Property: "scores",
+		Min:      0,
+		Max:      100,
+	}
+	if count, _ := q.Count(); count != 2 {
+		t.Errorf("should be 2: %d", count)
+	}
+}
+
+func TestFilterCompositeFilters(t *testing.T) {
+	// setup database
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	ds, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer ds.Close()
+
+	bucket := ds.Bucket("zoo")
+	bucket.PutRaw([]byte("key1"), []byte(`{"name": "joe", "class": "lion", "age": 5}`))
+	bucket.PutRaw([]byte("key2"), []byte(`{"name": "foo", "class": "lion", "age": 13}`))
+	bucket.PutRaw([]byte("key3"), []byte(`{"name": "coo", "class": "tiger", "age": 6}`))
+	bucket.PutRaw([]byte("key4"), []byte(`{"name": "tony", "class": "horse", "age": 2}`))
+	bucket.PutRaw([]byte("key5"), []byte(`{"name": "leo", "class": "lion", "age": 3}`))
+
+	// and
+	q := bucket.Query()
+	q.Filter = &AndFilter{
+		Filters: []Filter{
+			&PropValueMatchFilter{Property: "class", Match: "lion"},
+			&PropValueRangeFilter{Property: "age", Min: 3, Max: 10},
+		},
+	}
+
+	items, err := q.AsList()
+	if len(items) != 2 || string(items[0].Key) != "key1" || string(items[1].Key) != "key5" {
+		t.Errorf("unmatch: %v", items)
+	}
+
+	// or
+	q = bucket.Query()
+	q.Filter = &OrFilter{
+		Filters: []Filter{
+			&PropValueMatchFilter{Property: "class", Match: "tiger"},
+			&PropValueMatchFilter{Property: "class", Match: "horse"},
+			&KeyPrefixFilter{Prefix: []byte("key3")},
+		},
+		OrderBy: OrderByDesc,
+	}
+
+	items, err = q.AsList()
+	if len(items) != 2 || string(items[0].Key) != "key4" || string(items[1].Key) != "key3" {
+		t.Errorf("unmatch: %v", items)
+	}
+
+	// not
+	q = bucket.Query()
+	q.Filter = &NotFilter{
+		Filter: &PropValueMatchFilter{Property: "class", Match: "lion"},
+	}
+
+	items, err = q.AsList()
+	if len(items) != 2 || string(items[0].Key) != "key3" || string(items[1].Key) != "key4" {
+		t.Errorf("unmatch: %v", items)
+	}
+
+	// nested with offset and limit
+	q = bucket.Query()
+	q.Offset = 1
+	q.Limit = 1
+	q.Filter = &AndFilter{
+		Filters: []Filter{
+			&NotFilter{Filter: &PropValueMatchFilter{Property: "class", Match: "horse"}},
+			&OrFilter{Filters: []Filter{
+				&PropValueRangeFilter{Property: "age", Min: 5, Max: 6},
+				&PropValueMatchFilter{Property: "name", Match: "leo"},
+			}},
+		},
+	}
+
+	items, err = q.AsList()
+	if len(items) != 1 || string(items[0].Key) != "key3" {
+		t.Errorf("unmatch: %v", items)
+	}
+
+	// each item is checked by the indexes of the child filters.
+	bucket.AddCompoundIndex("class", "age")
+	bucket.AddTextIndex("name", false)
+
+	q = bucket.Query()
+	q.Filter = &AndFilter{
+		Filters: []Filter{
+			&KeyRangeFilter{Min: []byte("key1"), Max: []byte("key4")},
+			&OrFilter{Filters: []Filter{
+				&CompoundIndexFilter{Properties: []string{"class", "age"}, Match: []interface{}{"lion"}, Min: 10},
+				&TextSearchFilter{Property: "name", Text: "coo"},
+				&PropValuePrefixFilter{Property: "name", Prefix: "to"},
+			}},
+			&NotFilter{Filter: &PropValueMatchFilter{Property: "age", Match: 2}},
+		},
+		OrderBy: OrderByDesc,
+	}
+
+	items, err = q.AsList()
+	if len(items) != 2 || string(items[0].Key) != "key3" || string(items[1].Key) != "key2" {
+		t.Errorf("unmatch: %v", items)
+	}
+
+	// the items are found by the index of the first filter and checked by the others.
+	age := &matchCountingFilter{Filter: &PropValueRangeFilter{Property: "age", Min: 3, Max: 10}}
+	q = bucket.Query()
+	q.Filter = &AndFilter{
+		Filters: []Filter{
+			age,
+			&PropValueMatchFilter{Property: "class", Match: "lion"},
+		},
+	}
+
+	items, err = q.AsList()
+	if len(items) != 2 || string(items[0].Key) != "key1" || string(items[1].Key) != "key5" {
+		t.Errorf("unmatch: %v", items)
+	}
+	// only the lions are checked.
+	if age.matched != 3 {
+		t.Errorf("should be 3: %d", age.matched)
+	}
+
+	name := &matchCountingFilter{Filter: &PropValuePrefixFilter{Property: "name", Prefix: "t"}}
+	age = &matchCountingFilter{Filter: &PropValueRangeFilter{Property: "age", Min: 3, Max: 5}}
+	q = bucket.Query()
+	q.Filter = &AndFilter{Filters: []Filter{age, name}}
+
+	items, err = q.AsList()
+	if len(items) != 0 {
+		t.Errorf("unmatch: %v", items)
+	}
+	if age.matched != 0 || name.matched != 2 {
+		t.Errorf("unmatch: %d, %d", age.matched, name.matched)
+	}
+
+	// the keys found by the indexes are merged.
+	tiger := &matchCountingFilter{Filter: &PropValueMatchFilter{Property: "class", Match: "tiger"}}
+	q = bucket.Query()
+	q.Filter = &OrFilter{Filters: []Filter{tiger, age}}
+
+	items, err = q.AsList()
+	if len(items) != 3 || string(items[0].Key) != "key1" || string(items[1].Key) != "key3" || string(items[2].Key) != "key5" {
+		t.Errorf("unmatch: %v", items)
+	}
+	if tiger.matched != 0 || age.matched != 0 {
+		t.Errorf("unmatch: %d, %d", tiger.matched, age.matched)
+	}
+
+	// not reads all items.
+	q = bucket.Query()
+	q.Filter = &OrFilter{Filters: []Filter{tiger, &NotFilter{Filter: age}}}
+
+	items, err = q.AsList()
+	if len(items) != 3 || string(items[0].Key) != "key2" || string(items[1].Key) != "key3" || string(items[2].Key) != "key4" {
+		t.Errorf("unmatch: %v", items)
+	}
+	// all items except the tiger are checked.
+	if age.matched != 4 {
+		t.Errorf("should be 4: %d", age.matched)
+	}
+}
+
+// matchCountingFilter counts the items checked by the filter one by one.
+type matchCountingFilter struct {
+	Filter
+	matched int
+}
+
+func (filter *matchCountingFilter) match(bucket *BaseBucket, key []byte, value []byte) (bool, error) {
+	filter.matched++
+	return filter.Filter.match(bucket, key, value)
+}
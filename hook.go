@@ -0,0 +1,105 @@
+package bucketstore
+
+// Hook is a callback of writes of a bucket. It runs in the transaction of the write,
+// so it can write to other buckets by the transaction.
+// If it returns an error, the write fails and the transaction should be rolled back.
+//
+// The value is the new value for the put hooks, and is the deleted value for the delete hooks.
+// It is only valid in the hook.
+type Hook func(tx *Tx, key []byte, value []byte) error
+
+// bucketHooks is the hooks registered to a bucket.
+type bucketHooks struct {
+	beforePut    []Hook
+	afterPut     []Hook
+	beforeDelete []Hook
+	afterDelete  []Hook
+}
+
+// BeforePut registers the hook that runs before putting an item of the bucket.
+// The value is the value to put. An error of the hook vetoes the put.
+func (bucket *Bucket) BeforePut(fn Hook) {
+	bucket.datastore.addHook(bucket.name, func(h *bucketHooks) {
+		h.beforePut = append(h.beforePut, fn)
+	})
+}
+
+// AfterPut registers the hook that runs after putting an item of the bucket.
+// The value is the stored value.
+func (bucket *Bucket) AfterPut(fn Hook) {
+	bucket.datastore.addHook(bucket.name, func(h *bucketHooks) {
+		h.afterPut = append(h.afterPut, fn)
+	})
+}
+
+// BeforeDelete registers the hook that runs before deleting an item of the bucket.
+// It doesn't run if the item doesn't exist. An error of the hook vetoes the deletion.
+// The delete hooks don't run for the expired items that are deleted by the next write of the key or the reaper.
+func (bucket *Bucket) BeforeDelete(fn Hook) {
+	bucket.datastore.addHook(bucket.name, func(h *bucketHooks) {
+		h.beforeDelete = append(h.beforeDelete, fn)
+	})
+}
+
+// AfterDelete registers the hook that runs after deleting an item of the bucket.
+// It doesn't run if the item doesn't exist.
+func (bucket *Bucket) AfterDelete(fn Hook) {
+	bucket.datastore.addHook(bucket.name, func(h *bucketHooks) {
+		h.afterDelete = append(h.afterDelete, fn)
+	})
+}
+
+// OnCommit registers the function that runs after the transaction is committed successfully.
+// It doesn't run if the transaction is rolled back.
+func (tx *Tx) OnCommit(fn func()) {
+	tx.internalTx.OnCommit(fn)
+}
+
+func (db *DB) addHook(name string, fn func(*bucketHooks)) {
+	db.hooksMutex.Lock()
+	defer db.hooksMutex.Unlock()
+
+	if db.hooks == nil {
+		db.hooks = map[string]*bucketHooks{}
+	}
+
+	h, ok := db.hooks[name]
+	if !ok {
+		h = &bucketHooks{}
+		db.hooks[name] = h
+	}
+
+	fn(h)
+}
+
+// hooksOf gets a copy of the hooks of the bucket, so that registering hooks doesn't affect running writes.
+func (db *DB) hooksOf(name string) bucketHooks {
+	db.hooksMutex.RLock()
+	defer db.hooksMutex.RUnlock()
+
+	if h, ok := db.hooks[name]; ok {
+		return *h
+	}
+
+	return bucketHooks{}
+}
+
+// hooks gets the hooks of the bucket.
+func (b *BaseBucket) hooks() bucketHooks {
+	// the transaction of the migration doesn't have the database.
+	if b.tx.db == nil {
+		return bucketHooks{}
+	}
+
+	return b.tx.db.hooksOf(string(b.name))
+}
+
+func (b *BaseBucket) runHooks(hooks []Hook, key []byte, value []byte) error {
+	for _, fn := range hooks {
+		if err := fn(b.tx, key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,244 @@
+package bucketstore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBucketHooks(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	logs := []string{}
+
+	zoo := db.Bucket("zoo")
+	zoo.BeforePut(func(tx *Tx, key []byte, value []byte) error {
+		if string(key) == "ng" {
+			return fmt.Errorf("vetoed")
+		}
+		logs = append(logs, "before put "+string(key)+" "+string(value))
+		return nil
+	})
+	zoo.AfterPut(func(tx *Tx, key []byte, value []byte) error {
+		logs = append(logs, "after put "+string(key)+" "+string(value))
+
+		// writes the audit row in the same transaction.
+		audit, err := tx.CreateBucketIfNotExists("audit")
+		if err != nil {
+			return err
+		}
+		return audit.PutRaw(key, value)
+	})
+	zoo.BeforeDelete(func(tx *Tx, key []byte, value []byte) error {
+		logs = append(logs, "before delete "+string(key)+" "+string(value))
+		return nil
+	})
+	zoo.AfterDelete(func(tx *Tx, key []byte, value []byte) error {
+		logs = append(logs, "after delete "+string(key)+" "+string(value))
+		return nil
+	})
+
+	if err := zoo.PutRaw([]byte("key1"), []byte(`{"name": "joe"}`)); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if err := zoo.PutRaw([]byte("ng"), []byte(`{"name": "foo"}`)); err == nil {
+		t.Errorf("should raise error")
+	}
+	if item, _ := zoo.Get([]byte("ng")); item != nil {
+		t.Errorf("should be nil: %v", item)
+	}
+	if err := zoo.Delete([]byte("key1")); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	// the delete hooks don't run for the missing item.
+	if err := zoo.Delete([]byte("key1")); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	expected := []string{
+		`before put key1 {"name": "joe"}`,
+		`after put key1 {"name":"joe"}`,
+		`before delete key1 {"name":"joe"}`,
+		`after delete key1 {"name":"joe"}`,
+	}
+	if fmt.Sprint(logs) != fmt.Sprint(expected) {
+		t.Errorf("unmatch: %v", logs)
+	}
+
+	if v, _ := db.Bucket("audit").GetRaw([]byte("key1")); string(v) != `{"name":"joe"}` {
+		t.Errorf("unmatch: %s", v)
+	}
+
+	// an error of the after hook rolls back the write and the writes of the hooks.
+	farm := db.Bucket("farm")
+	farm.AfterPut(func(tx *Tx, key []byte, value []byte) error {
+		counter, err := tx.CreateBucketIfNotExists("counter")
+		if err != nil {
+			return err
+		}
+		if err := counter.PutRaw([]byte("farm"), []byte(`{"count": 1}`)); err != nil {
+			return err
+		}
+		return fmt.Errorf("failed")
+	})
+	if err := farm.PutRaw([]byte("key1"), []byte(`{"name": "joe"}`)); err == nil {
+		t.Errorf("should raise error")
+	}
+	if item, _ := farm.Get([]byte("key1")); item != nil {
+		t.Errorf("should be nil: %v", item)
+	}
+	if exists, _ := db.Bucket("counter").Exists(); exists {
+		t.Errorf("should not exist")
+	}
+}
+
+func TestBucketHooksWithTTL(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	options := NewOptions()
+	options.ChangeLog = true
+
+	db, err := Open(tmpFile.Name(), 0600, options)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	logs := []string{}
+
+	sessions := db.Bucket("sessions")
+	sessions.BeforeDelete(func(tx *Tx, key []byte, value []byte) error {
+		return fmt.Errorf("vetoed")
+	})
+	sessions.AfterDelete(func(tx *Tx, key []byte, value []byte) error {
+		logs = append(logs, "after delete "+string(key))
+		return nil
+	})
+
+	sessions.PutWithTTL([]byte("key1"), []byte(`{"user": "joe"}`), time.Minute)
+	sessions.PutWithTTL([]byte("key2"), []byte(`{"user": "foo"}`), time.Minute)
+	sessions.PutWithTTL([]byte("key3"), []byte(`{"user": "bar"}`), time.Minute)
+	now = now.Add(time.Hour)
+
+	// the put hooks see the expired item as absent.
+	sessions.BeforePut(func(tx *Tx, key []byte, value []byte) error {
+		if tx.bData().Bucket([]byte("sessions")).Get(key) != nil {
+			logs = append(logs, "before put existing "+string(key))
+		}
+		return nil
+	})
+
+	// the expired item is replaced without the delete hooks.
+	if err := sessions.PutRaw([]byte("key1"), []byte(`{"user": "coo"}`)); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if item, _ := sessions.Get([]byte("key1")); item == nil || string(item.Value) != `{"user":"coo"}` {
+		t.Errorf("unmatch: %v", item)
+	}
+
+	// deleting the expired item doesn't run the delete hooks.
+	if err := sessions.Delete([]byte("key3")); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	// the reaper deletes the expired item without the delete hooks.
+	if n, err := db.ReapExpired(); err != nil || n != 1 {
+		t.Errorf("should be 1: %d, %v", n, err)
+	}
+	if len(logs) != 0 {
+		t.Errorf("unmatch: %v", logs)
+	}
+
+	w := db.Watch("sessions", 3)
+	defer w.Close()
+
+	expected := []ChangeType{ChangeTypeExpire, ChangeTypePut, ChangeTypeExpire, ChangeTypeExpire}
+	for i, changeType := range expected {
+		if !w.Next() {
+			t.Fatalf("should get the event %d: %v", i, w.Err())
+		}
+		if w.Event().Type != changeType {
+			t.Errorf("should be %s: %v", changeType, w.Event())
+		}
+	}
+	if string(w.Event().Key) != "key2" || string(w.Event().Before) != `{"user":"foo"}` || w.Event().After != nil {
+		t.Errorf("unmatch: %v", w.Event())
+	}
+}
+
+func TestTxOnCommit(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	committed := []string{}
+	db.Bucket("zoo").AfterPut(func(tx *Tx, key []byte, value []byte) error {
+		k := string(key)
+		tx.OnCommit(func() {
+			committed = append(committed, k)
+		})
+		return nil
+	})
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	bucket, _ := tx.CreateBucketIfNotExists("zoo")
+	bucket.PutRaw([]byte("key1"), []byte(`{}`))
+	if len(committed) != 0 {
+		t.Errorf("should not run before committing: %v", committed)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	tx, err = db.Begin(true)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	bucket, _ = tx.Bucket("zoo")
+	bucket.PutRaw([]byte("key2"), []byte(`{}`))
+	tx.Rollback()
+
+	if fmt.Sprint(committed) != "[key1]" {
+		t.Errorf("unmatch: %v", committed)
+	}
+}
@@ -1,25 +1,126 @@
 package bucketstore
 
+import (
+	"encoding/binary"
+)
+
+//
+// # Index value specification.
+//
+// The value of an index entry is the key of the item.
+// If the item has multiple values of the property by an array, the previous and the next values of the item
+// in the index order follow the key. The values of an item matching a filter are contiguous in the index,
+// so a scan can find whether the item has been found by another value without reading the item.
+//
+//   <key> [+ <length of prev:2 bytes> + <prev> + <next>]
+//
+// <prev> and <next> are <valueType> + <value> of the index keys. They are empty if there is no value before or after.
+//
+
 type Index struct {
 	bucket *BaseBucket
 	// key is a index key for searching.
 	key []byte
 	// ref is a key of actual key/value pair.
 	ref []byte
+	// prev and next are the previous and the next values of the array property of the item in the index order.
+	prev []byte
+	next []byte
 }
 
-func newIndex(bucket *BaseBucket, key []byte, ref []byte) *Index {
-	return &Index{
+func newIndex(bucket *BaseBucket, key []byte, value []byte) *Index {
+	idx := &Index{
 		bucket: bucket,
 		key:    key,
-		ref:    ref,
+		ref:    value,
+	}
+
+	// the key of the item is the rest of the index key.
+	// the value is not longer than it unless the item has multiple values.
+	valueBytes, err := getValueFromIndexKey(key)
+	if err != nil {
+		return idx
+	}
+
+	refLen := len(key) - len(valueBytes) - 3
+	if refLen < 0 || len(value) < refLen+2 {
+		return idx
 	}
+
+	idx.ref = value[:refLen]
+	neighbors := value[refLen+2:]
+	prevLen := int(binary.BigEndian.Uint16(value[refLen : refLen+2]))
+	if prevLen > len(neighbors) {
+		return idx
+	}
+
+	idx.prev = neighbors[:prevLen]
+	idx.next = neighbors[prevLen:]
+	return idx
+}
+
+// genIndexValue generates the value of the index entry.
+// prev and next are the index keys of the previous and the next values of the item, or nil.
+func genIndexValue(key []byte, prev []byte, next []byte) []byte {
+	if prev == nil && next == nil {
+		return key
+	}
+
+	// the index key is <valueType> + <value> + <sep1> + <sep2> + <key>.
+	if prev != nil {
+		prev = prev[:len(prev)-len(key)-2]
+	}
+	if next != nil {
+		next = next[:len(next)-len(key)-2]
+	}
+
+	l := make([]byte, 2)
+	binary.BigEndian.PutUint16(l, uint16(len(prev)))
+
+	return append(append(append(append([]byte{}, key...), l...), prev...), next...)
+}
+
+// genIndexEntries generates the index keys of the values of the property of the item in the index order,
+// and the values of the index entries.
+func genIndexEntries(config *IndexConfig, propName string, values []interface{}, key []byte) ([][]byte, [][]byte) {
+	indexKeys := [][]byte{}
+	for _, v := range values {
+		indexKey := genIndexKey(config.indexValue(propName, v), key)
+		if indexKey == nil {
+			continue
+		}
+
+		indexKeys = append(indexKeys, indexKey)
+	}
+
+	// the same values of an array have the same index key.
+	indexKeys = sortKeys(indexKeys, OrderByAsc)
+
+	entryValues := make([][]byte, len(indexKeys))
+	for i := range indexKeys {
+		var prev, next []byte
+		if i > 0 {
+			prev = indexKeys[i-1]
+		}
+		if i < len(indexKeys)-1 {
+			next = indexKeys[i+1]
+		}
+
+		entryValues[i] = genIndexValue(key, prev, next)
+	}
+
+	return indexKeys, entryValues
 }
 
 func (idx *Index) Data() (key []byte, value []byte) {
 	return idx.ref, idx.bucket.Get(idx.ref)
 }
 
+// Key returns the key of the actual key/value pair without getting the value.
+func (idx *Index) Key() []byte {
+	return idx.ref
+}
+
 func (idx *Index) ValueType() byte {
 	return idx.key[0]
 }
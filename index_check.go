@@ -0,0 +1,355 @@
+package bucketstore
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// defaultRebuildBatchSize is the number of items indexed in a write transaction by default.
+const defaultRebuildBatchSize = 1000
+
+// ErrIndexesRebuilding is returned when a write checks a unique constraint or a query reads the indexes
+// of the bucket while they are being rebuilt, because the indexes are incomplete.
+type ErrIndexesRebuilding struct {
+	Bucket string
+}
+
+func (e *ErrIndexesRebuilding) Error() string {
+	return fmt.Sprintf("the indexes of the bucket %s are being rebuilt", e.Bucket)
+}
+
+// IndexReport is a result of checking the indexes of a bucket.
+type IndexReport struct {
+	Bucket string `json:"bucket"`
+	// MissingIndexBucket is true if the index bucket of the bucket itself doesn't exist.
+	MissingIndexBucket bool `json:"missing_index_bucket,omitempty"`
+	// MissingIndexBuckets are the names of the index buckets that don't exist though they should have entries.
+	MissingIndexBuckets []string `json:"missing_index_buckets,omitempty"`
+	// Orphaned are the index entries that don't match any items.
+	Orphaned []*IndexEntry `json:"orphaned,omitempty"`
+	// Missing are the index entries of the items that don't exist.
+	Missing []*IndexEntry `json:"missing,omitempty"`
+}
+
+// OK reports whether the indexes are consistent with the items.
+func (r *IndexReport) OK() bool {
+	return !r.MissingIndexBucket && len(r.MissingIndexBuckets) == 0 && len(r.Orphaned) == 0 && len(r.Missing) == 0
+}
+
+// IndexEntry is an entry of an index bucket.
+type IndexEntry struct {
+	// Index is the name of the index bucket. It is the property name for the property indexes.
+	Index string `json:"index"`
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+	// Ref is the key of the item that the entry refers to.
+	Ref []byte `json:"ref"`
+}
+
+// CheckIndexes checks that the indexes of the bucket are consistent with the items
+// and reports the differences. It doesn't modify anything.
+// It keeps the expected index entries of all items in memory.
+func (db *DB) CheckIndexes(bucket string) (report *IndexReport, err error) {
+	name := []byte(bucket)
+
+	err = db.View(func(tx *Tx) error {
+		data := tx.bData().Bucket(name)
+		if data == nil {
+			return fmt.Errorf("the bucket %s doesn't exist", bucket)
+		}
+
+		// it doesn't use Tx.baseBucket because the index bucket may not exist.
+		index := tx.bIndex().Bucket(name)
+		b := newBaseBucket(name, tx, data, index)
+
+		report = &IndexReport{
+			Bucket:             bucket,
+			MissingIndexBucket: index == nil,
+		}
+
+		// expected index entries per index bucket name.
+		expected := map[string]map[string]*IndexEntry{}
+		if b.isIndexable() {
+			err := data.ForEach(func(key, value []byte) error {
+				var jsonMap map[string]interface{}
+				if err := decodeJSON(value, &jsonMap); err != nil {
+					// the items that are not json objects are not indexed.
+					return nil
+				}
+
+				return b.indexEntries(key, jsonMap, func(entry *IndexEntry) {
+					entries, ok := expected[entry.Index]
+					if !ok {
+						entries = map[string]*IndexEntry{}
+						expected[entry.Index] = entries
+					}
+					entries[string(entry.Key)] = entry
+				})
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if index != nil {
+			err := index.ForEach(func(n, v []byte) error {
+				if v != nil {
+					// not a bucket.
+					return nil
+				}
+
+				entries := expected[string(n)]
+				return index.Bucket(n).ForEach(func(k, v []byte) error {
+					if entry, ok := entries[string(k)]; ok && bytes.Equal(entry.Value, v) {
+						delete(entries, string(k))
+						return nil
+					}
+
+					report.Orphaned = append(report.Orphaned, &IndexEntry{
+						Index: string(n),
+						Key:   append([]byte{}, k...),
+						Value: append([]byte{}, v...),
+						Ref:   indexEntryRef(string(n), k, v),
+					})
+					return nil
+				})
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		names := make([]string, 0, len(expected))
+		for n := range expected {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+		for _, n := range names {
+			if len(expected[n]) == 0 {
+				continue
+			}
+
+			if index == nil || index.Bucket([]byte(n)) == nil {
+				report.MissingIndexBuckets = append(report.MissingIndexBuckets, n)
+			}
+
+			keys := make([]string, 0, len(expected[n]))
+			for k := range expected[n] {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			for _, k := range keys {
+				report.Missing = append(report.Missing, expected[n][k])
+			}
+		}
+
+		return nil
+	})
+
+	return report, err
+}
+
+// RebuildIndexes deletes all indexes of the bucket and creates them from the items in batched write transactions.
+// It also recreates the index bucket of the bucket if it doesn't exist.
+// The indexes are incomplete until it finishes, so the writes checking unique constraints and the queries reading
+// the indexes of the bucket fail with ErrIndexesRebuilding meanwhile. The other writes keep the indexes as usual.
+// It returns the number of the indexed items.
+func (db *DB) RebuildIndexes(bucket string) (int, error) {
+	if !db.startRebuilding(bucket) {
+		return 0, fmt.Errorf("the indexes of the bucket %s are already being rebuilt", bucket)
+	}
+	defer db.finishRebuilding(bucket)
+
+	batchSize := db.options.RebuildBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultRebuildBatchSize
+	}
+
+	name := []byte(bucket)
+
+	err := db.Update(func(tx *Tx) error {
+		data := tx.bData().Bucket(name)
+		if data == nil {
+			return fmt.Errorf("the bucket %s doesn't exist", bucket)
+		}
+
+		index, err := tx.bIndex().CreateBucketIfNotExists(name)
+		if err != nil {
+			return err
+		}
+
+		return newBaseBucket(name, tx, data, index).deleteAllIndexBuckets()
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	var next []byte
+	for {
+		n := 0
+		err := db.Update(func(tx *Tx) error {
+			b, err := tx.baseBucket(name)
+			if err != nil {
+				return err
+			}
+
+			if b == nil {
+				return fmt.Errorf("the bucket %s was deleted while rebuilding the indexes", bucket)
+			}
+
+			if !b.isIndexable() {
+				next = nil
+				return nil
+			}
+
+			if err := b.createCompoundIndexBuckets(); err != nil {
+				return err
+			}
+
+			c := b.Cursor()
+			k, v := c.First()
+			if next != nil {
+				k, v = c.Seek(next)
+			}
+
+			for ; k != nil; k, v = c.Next() {
+				if n >= batchSize {
+					next = append([]byte{}, k...)
+					return nil
+				}
+
+				n++
+
+				var jsonMap map[string]interface{}
+				if err := decodeJSON(v, &jsonMap); err != nil {
+					continue
+				}
+
+				if err := b.putIndex(k, jsonMap, nil); err != nil {
+					return err
+				}
+
+				if err := b.refreshCompoundIndex(k, nil, jsonMap); err != nil {
+					return err
+				}
+
+				if err := b.refreshTextIndex(k, nil, jsonMap); err != nil {
+					return err
+				}
+			}
+
+			next = nil
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+
+		total += n
+		if next == nil {
+			break
+		}
+	}
+
+	return total, nil
+}
+
+// startRebuilding marks the bucket as rebuilding the indexes. It returns false if it has been marked.
+func (db *DB) startRebuilding(bucket string) bool {
+	db.rebuildingMutex.Lock()
+	defer db.rebuildingMutex.Unlock()
+
+	if db.rebuilding[bucket] {
+		return false
+	}
+
+	if db.rebuilding == nil {
+		db.rebuilding = map[string]bool{}
+	}
+	db.rebuilding[bucket] = true
+	return true
+}
+
+func (db *DB) finishRebuilding(bucket string) {
+	db.rebuildingMutex.Lock()
+	defer db.rebuildingMutex.Unlock()
+
+	delete(db.rebuilding, bucket)
+}
+
+// checkNotRebuilding returns ErrIndexesRebuilding if the indexes of the bucket are being rebuilt.
+// The bucket is marked before the indexes are deleted and unmarked after they are completed,
+// so a transaction that sees incomplete indexes always sees the mark.
+func (b *BaseBucket) checkNotRebuilding() error {
+	// the transaction of the migration doesn't have the database.
+	if b.tx.db == nil {
+		return nil
+	}
+
+	b.tx.db.rebuildingMutex.Lock()
+	defer b.tx.db.rebuildingMutex.Unlock()
+
+	if b.tx.db.rebuilding[string(b.name)] {
+		return &ErrIndexesRebuilding{Bucket: string(b.name)}
+	}
+
+	return nil
+}
+
+// indexEntries generates the index entries of the item in the same way as the indexes are created.
+func (b *BaseBucket) indexEntries(key []byte, jsonMap map[string]interface{}, fn func(*IndexEntry)) error {
+	config, err := b.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	// the key is only valid in the transaction.
+	ref := append([]byte{}, key...)
+	props := flattenProperties(jsonMap)
+
+	for n, values := range props {
+		if !config.IsIndexed(n) {
+			continue
+		}
+
+		indexKeys, entryValues := genIndexEntries(config, n, values, ref)
+		for i, indexKey := range indexKeys {
+			fn(&IndexEntry{Index: n, Key: indexKey, Value: entryValues[i], Ref: ref})
+		}
+	}
+
+	for _, propNames := range config.Compound {
+		indexKey := genCompoundIndexKey(config, propNames, props, key)
+		if indexKey == nil {
+			continue
+		}
+
+		fn(&IndexEntry{Index: compoundIndexName(propNames), Key: indexKey, Value: ref, Ref: ref})
+	}
+
+	for _, textIndex := range config.Text {
+		for term, tf := range termFrequencies(props[textIndex.Property], textIndex.CJKBigram) {
+			fn(&IndexEntry{Index: textIndexName(textIndex.Property), Key: genTextIndexKey(term, key), Value: Uint64ToBytes(tf), Ref: ref})
+		}
+	}
+
+	return nil
+}
+
+// indexEntryRef gets the key of the item from the entry of the index bucket.
+func indexEntryRef(indexName string, key []byte, value []byte) []byte {
+	if isTextIndexName(indexName) {
+		// the value of the text index is the term frequency.
+		if i := bytes.Index(key, []byte{sep1, sep2}); i >= 0 {
+			return append([]byte{}, key[i+2:]...)
+		}
+		return nil
+	}
+
+	// the value of the property index may have the other values of the item after the key.
+	return append([]byte{}, newIndex(nil, key, value).ref...)
+}
@@ -0,0 +1,216 @@
+package bucketstore
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCheckIndexesAndRebuildIndexes(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	options := NewOptions()
+	options.RebuildBatchSize = 2
+
+	db, err := Open(tmpFile.Name(), 0600, options)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	bucket := db.Bucket("zoo")
+	bucket.AddCompoundIndex("class", "age")
+	bucket.AddTextIndex("note", false)
+	bucket.PutRaw([]byte("key1"), []byte(`{"name": "joe", "class": "lion", "age": 5, "note": "a big lion"}`))
+	bucket.PutRaw([]byte("key2"), []byte(`{"name": "foo", "class": "lion", "age": 13}`))
+	bucket.PutRaw([]byte("key3"), []byte(`{"name": "coo", "class": "tiger", "age": 6, "note": "a tiger"}`))
+	bucket.PutRaw([]byte("key4"), []byte(`{"name": "tony", "class": "horse", "age": 2}`))
+	bucket.PutRaw([]byte("key5"), []byte(`{"name": "lulu", "class": "horse", "age": 1}`))
+
+	report, err := db.CheckIndexes("zoo")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("should be ok: %v", report)
+	}
+
+	if _, err := db.CheckIndexes("farm"); err == nil {
+		t.Errorf("should raise error")
+	}
+
+	// breaks the indexes.
+	err = db.Update(func(tx *Tx) error {
+		index := tx.bIndex().Bucket([]byte("zoo"))
+
+		// a missing entry.
+		if err := index.Bucket([]byte("name")).Delete(genIndexKey("joe", []byte("key1"))); err != nil {
+			return err
+		}
+
+		// an orphaned entry.
+		if err := index.Bucket([]byte(textIndexName("note"))).Put(genTextIndexKey("zebra", []byte("key9")), Uint64ToBytes(1)); err != nil {
+			return err
+		}
+
+		// a missing index bucket.
+		return index.DeleteBucket([]byte("class"))
+	})
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	report, err = db.CheckIndexes("zoo")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if report.OK() {
+		t.Errorf("should not be ok")
+	}
+	if report.MissingIndexBucket {
+		t.Errorf("should be false")
+	}
+	if len(report.MissingIndexBuckets) != 1 || report.MissingIndexBuckets[0] != "class" {
+		t.Errorf("unmatch: %v", report.MissingIndexBuckets)
+	}
+	if len(report.Orphaned) != 1 || report.Orphaned[0].Index != textIndexName("note") || string(report.Orphaned[0].Ref) != "key9" {
+		t.Errorf("unmatch: %v", report.Orphaned)
+	}
+	// 5 entries of the class and 1 entry of the name.
+	if len(report.Missing) != 6 {
+		t.Errorf("should be 6: %d", len(report.Missing))
+	}
+	for _, e := range report.Missing {
+		if e.Index != "class" && (e.Index != "name" || string(e.Ref) != "key1") {
+			t.Errorf("unmatch: %v", e)
+		}
+	}
+
+	n, err := db.RebuildIndexes("zoo")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if n != 5 {
+		t.Errorf("should be 5: %d", n)
+	}
+
+	report, err = db.CheckIndexes("zoo")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("should be ok: %v", report)
+	}
+
+	// loses the whole index bucket.
+	err = db.Update(func(tx *Tx) error {
+		return tx.bIndex().DeleteBucket([]byte("zoo"))
+	})
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	if _, err := bucket.Get([]byte("key1")); err == nil {
+		t.Errorf("should raise error")
+	}
+
+	report, err = db.CheckIndexes("zoo")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if !report.MissingIndexBucket {
+		t.Errorf("should be true")
+	}
+
+	if _, err := db.RebuildIndexes("zoo"); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	report, err = db.CheckIndexes("zoo")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("should be ok: %v", report)
+	}
+
+	q := bucket.Query()
+	q.Filter = &PropValueMatchFilter{Property: "class", Match: "horse"}
+	if count, _ := q.Count(); count != 2 {
+		t.Errorf("should be 2: %d", count)
+	}
+}
+
+func TestRebuildingIndexes(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	bucket := db.Bucket("zoo")
+	if err := bucket.AddUniqueIndex("name"); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	bucket.PutRaw([]byte("key1"), []byte(`{"name": "joe", "age": 5}`))
+	bucket.PutRaw([]byte("key2"), []byte(`{"name": "foo", "age": 13}`))
+
+	// the bucket is marked while the batches of RebuildIndexes are running.
+	if !db.startRebuilding("zoo") {
+		t.Errorf("should be true")
+	}
+
+	if _, err := db.RebuildIndexes("zoo"); err == nil {
+		t.Errorf("should raise error")
+	}
+
+	err = bucket.PutRaw([]byte("key3"), []byte(`{"name": "joe", "age": 2}`))
+	if _, ok := err.(*ErrIndexesRebuilding); !ok {
+		t.Errorf("should be ErrIndexesRebuilding: %v", err)
+	}
+
+	q := bucket.Query()
+	q.Filter = &PropValueMatchFilter{Property: "age", Match: 5}
+	if _, err := q.AsList(); err == nil {
+		t.Errorf("should raise error")
+	}
+
+	// the queries that don't read the indexes work.
+	q = bucket.Query()
+	q.Filter = &KeyPrefixFilter{Prefix: []byte("key")}
+	q.SortBy = []SortKey{{Property: "age", OrderBy: OrderByDesc}}
+	items, err := q.AsList()
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if len(items) != 2 || string(items[0].Key) != "key2" {
+		t.Errorf("unmatch: %v", items)
+	}
+
+	db.finishRebuilding("zoo")
+
+	err = bucket.PutRaw([]byte("key3"), []byte(`{"name": "joe", "age": 2}`))
+	if _, ok := err.(*ErrUniqueViolation); !ok {
+		t.Errorf("should be ErrUniqueViolation: %v", err)
+	}
+
+	if _, err := db.RebuildIndexes("zoo"); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+}
@@ -0,0 +1,271 @@
+package bucketstore
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// IndexMode is a mode to decide which properties of items are indexed.
+type IndexMode string
+
+const (
+	// IndexModeAll indexes every property of items. It is the default mode.
+	IndexModeAll IndexMode = "all"
+	// IndexModeDeclared indexes only the properties declared by AddIndex.
+	IndexModeDeclared IndexMode = "declared"
+)
+
+// IndexConfig is an index configuration of a bucket.
+// It is stored in the index config bucket of the system area per bucket.
+type IndexConfig struct {
+	Mode IndexMode `json:"mode"`
+	// Properties are the declared property paths like 'address.city'.
+	// They are indexed in the declared mode.
+	Properties []string `json:"properties,omitempty"`
+	// Unique are the property paths that have unique constraints.
+	// They are declared in Properties as well.
+	Unique []string `json:"unique,omitempty"`
+	// Compound are the ordered property paths of the compound indexes.
+	// They are indexed regardless of the mode.
+	Compound [][]string `json:"compound,omitempty"`
+	// Text are the text indexes. They are indexed regardless of the mode.
+	Text []*TextIndex `json:"text,omitempty"`
+	// Collations are the collations of the string indexes per property path.
+	Collations map[string]*Collation `json:"collations,omitempty"`
+	// Integer are the property paths that index integers exactly.
+	// They are declared in Properties as well.
+	Integer []string `json:"integer,omitempty"`
+}
+
+func newIndexConfig() *IndexConfig {
+	return &IndexConfig{
+		Mode: IndexModeAll,
+	}
+}
+
+// IsIndexed checks whether the property is indexed by the configuration.
+func (config *IndexConfig) IsIndexed(propName string) bool {
+	if config.Mode != IndexModeDeclared {
+		return true
+	}
+
+	return config.isDeclared(propName)
+}
+
+func (config *IndexConfig) isDeclared(propName string) bool {
+	return containsString(config.Properties, propName)
+}
+
+func (config *IndexConfig) isUnique(propName string) bool {
+	return containsString(config.Unique, propName)
+}
+
+func (config *IndexConfig) hasCompound(propNames []string) bool {
+	for _, c := range config.Compound {
+		if compoundIndexName(c) == compoundIndexName(propNames) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (config *IndexConfig) textIndex(propName string) *TextIndex {
+	for _, t := range config.Text {
+		if t.Property == propName {
+			return t
+		}
+	}
+
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func removeString(list []string, s string) []string {
+	ret := []string{}
+	for _, v := range list {
+		if v != s {
+			ret = append(ret, v)
+		}
+	}
+
+	return ret
+}
+
+// IndexConfig gets the index configuration of the bucket.
+func (b *BaseBucket) IndexConfig() (*IndexConfig, error) {
+	if b.indexConfig != nil {
+		return b.indexConfig, nil
+	}
+
+	config := newIndexConfig()
+
+	// the database opened in the read only mode may not have the index config bucket.
+	if bucket := b.tx.bIndexConfig(); bucket != nil {
+		if v := bucket.Get(b.name); v != nil {
+			if err := json.Unmarshal(v, config); err != nil {
+				return nil, fmt.Errorf("the index config of %s was broken: %v", string(b.name), err)
+			}
+		}
+	}
+
+	b.indexConfig = config
+	return config, nil
+}
+
+// SetIndexMode changes the index mode of the bucket.
+// Changing to the declared mode drops the indexes of the undeclared properties.
+// Changing to the all mode creates the indexes of all properties of the existing items.
+func (b *BaseBucket) SetIndexMode(mode IndexMode) error {
+	if mode != IndexModeAll && mode != IndexModeDeclared {
+		return fmt.Errorf("unsupported index mode: %s", mode)
+	}
+
+	config, err := b.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	if config.Mode == mode {
+		return nil
+	}
+
+	config.Mode = mode
+	if err := b.putIndexConfig(config); err != nil {
+		return err
+	}
+
+	if mode == IndexModeAll {
+		return b.backfillIndex(nil)
+	}
+
+	props, err := b.IndexProperties()
+	if err != nil {
+		return err
+	}
+
+	for _, n := range props {
+		if config.IsIndexed(n) {
+			continue
+		}
+
+		if err := b.deleteIndexBucket(n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddIndex declares the property to be indexed and creates the index of the existing items.
+func (b *BaseBucket) AddIndex(propName string) error {
+	if propName == "" || isIgnorePattern(propName) {
+		return fmt.Errorf("invalid property name to index: %s", propName)
+	}
+
+	config, err := b.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	if config.isDeclared(propName) {
+		return nil
+	}
+
+	config.Properties = append(config.Properties, propName)
+	if err := b.putIndexConfig(config); err != nil {
+		return err
+	}
+
+	if config.Mode == IndexModeAll {
+		// it has been indexed already.
+		return nil
+	}
+
+	return b.backfillIndex(func(n string) bool {
+		return n == propName
+	})
+}
+
+// DropIndex removes the declaration of the property and its unique and integer constraints, and deletes the index.
+// The index is kept in the all mode, because every property is indexed.
+func (b *BaseBucket) DropIndex(propName string) error {
+	config, err := b.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	if !config.isDeclared(propName) {
+		return nil
+	}
+
+	integer := config.isInteger(propName)
+
+	config.Properties = removeString(config.Properties, propName)
+	config.Unique = removeString(config.Unique, propName)
+	config.Integer = removeString(config.Integer, propName)
+	if err := b.putIndexConfig(config); err != nil {
+		return err
+	}
+
+	if config.Mode == IndexModeAll {
+		if !integer || b.getIndexBucket(propName) == nil {
+			return nil
+		}
+
+		// rebuilds the index to index the integers as float64.
+		if err := b.deleteIndexBucket(propName); err != nil {
+			return err
+		}
+
+		return b.backfillIndex(func(n string) bool {
+			return n == propName
+		})
+	}
+
+	if b.getIndexBucket(propName) == nil {
+		return nil
+	}
+
+	return b.deleteIndexBucket(propName)
+}
+
+func (b *BaseBucket) putIndexConfig(config *IndexConfig) error {
+	v, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	if err := b.tx.bIndexConfig().Put(b.name, v); err != nil {
+		return err
+	}
+
+	b.indexConfig = config
+	return nil
+}
+
+// backfillIndex creates the index of the existing items.
+// If the match function is nil, it creates the index of all properties indexed by the configuration.
+func (b *BaseBucket) backfillIndex(match func(propName string) bool) error {
+	if !b.isIndexable() {
+		return nil
+	}
+
+	return b.data.ForEach(func(key, value []byte) error {
+		var jsonMap map[string]interface{}
+		if err := decodeJSON(value, &jsonMap); err != nil {
+			return nil
+		}
+
+		return b.putIndex(key, jsonMap, match)
+	})
+}
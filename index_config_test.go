@@ -0,0 +1,133 @@
+package bucketstore
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestIndexConfigDeclaredIndexes(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	bucket := db.Bucket("zoo")
+
+	// the default mode indexes all properties.
+	config, err := bucket.IndexConfig()
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if config.Mode != IndexModeAll {
+		t.Errorf("should be all mode: %v", config.Mode)
+	}
+
+	bucket.PutRaw([]byte("key1"), []byte(`{"name": "joe", "class": "lion", "address": {"city": "Tokyo"}}`))
+	bucket.PutRaw([]byte("key2"), []byte(`{"name": "foo", "class": "tiger", "address": {"city": "Osaka"}}`))
+
+	assertIndexProperties(t, bucket, []string{"address.city", "class", "name"})
+
+	if err := bucket.AddIndex("class"); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	// changing to the declared mode drops the undeclared indexes.
+	if err := bucket.SetIndexMode(IndexModeDeclared); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	assertIndexProperties(t, bucket, []string{"class"})
+
+	bucket.PutRaw([]byte("key3"), []byte(`{"name": "coo", "class": "lion", "address": {"city": "Tokyo"}}`))
+	assertIndexProperties(t, bucket, []string{"class"})
+
+	q := bucket.Query()
+	q.Filter = &PropValueMatchFilter{Property: "class", Match: "lion"}
+	if count, _ := q.Count(); count != 2 {
+		t.Errorf("should be 2: %d", count)
+	}
+
+	// adding an index creates the index of the existing items.
+	if err := bucket.AddIndex("address.city"); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	assertIndexProperties(t, bucket, []string{"address.city", "class"})
+
+	q = bucket.Query()
+	q.Filter = &PropValueMatchFilter{Property: "address.city", Match: "Tokyo"}
+	if count, _ := q.Count(); count != 2 {
+		t.Errorf("should be 2: %d", count)
+	}
+
+	if err := bucket.DropIndex("class"); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	assertIndexProperties(t, bucket, []string{"address.city"})
+
+	config, err = bucket.IndexConfig()
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if config.Mode != IndexModeDeclared || !reflect.DeepEqual(config.Properties, []string{"address.city"}) {
+		t.Errorf("unmatch: %v", config)
+	}
+
+	// changing to the all mode creates the indexes of all properties.
+	if err := bucket.SetIndexMode(IndexModeAll); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	assertIndexProperties(t, bucket, []string{"address.city", "class", "name"})
+
+	if err := bucket.SetIndexMode("unknown"); err == nil {
+		t.Errorf("should raise error")
+	}
+
+	// deleting the bucket deletes the config.
+	bucket.SetIndexMode(IndexModeDeclared)
+	if err := db.DeleteBucket("zoo"); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	config, err = bucket.IndexConfig()
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if config.Mode != IndexModeAll {
+		t.Errorf("should be all mode: %v", config.Mode)
+	}
+}
+
+func assertIndexProperties(t *testing.T, bucket *Bucket, expected []string) {
+	err := bucket.datastore.View(func(tx *Tx) error {
+		b, err := tx.Bucket(bucket.name)
+		if err != nil {
+			return err
+		}
+
+		props, err := b.BaseBucket().IndexProperties()
+		if err != nil {
+			return err
+		}
+
+		sort.Strings(props)
+		if !reflect.DeepEqual(props, expected) {
+			t.Errorf("unmatch: %v (expected %v)", props, expected)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+}
@@ -143,10 +143,12 @@ func (ic *IndexCursor) Get(value interface{}) *Index {
 		return nil
 	}
 
+	idx := newIndex(ic.bucket, k, v)
+
 	// checks exactly the same value.
-	if !bytes.Equal(k, genIndexKey(value, v)) {
+	if !bytes.Equal(k, genIndexKey(value, idx.ref)) {
 		return nil
 	}
 
-	return newIndex(ic.bucket, k, v)
+	return idx
 }
@@ -0,0 +1,95 @@
+package bucketstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// indexInt is an integer value of the property declared by AddIntegerIndex.
+// It is indexed as ValueTypeInt64 instead of ValueTypeFloat64.
+type indexInt int64
+
+// toIndexInt converts the number to indexInt if it is an integer in the range of int64.
+func toIndexInt(value interface{}) (indexInt, bool) {
+	switch v := value.(type) {
+	case indexInt:
+		return v, true
+	case int:
+		return indexInt(v), true
+	case int64:
+		return indexInt(v), true
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, false
+		}
+		return indexInt(v), true
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return indexInt(i), true
+		}
+
+		// a number like 1.0 or 1e3.
+		f, err := v.Float64()
+		if err != nil {
+			return 0, false
+		}
+		return toIndexInt(f)
+	case float64:
+		// float64(math.MaxInt64) is rounded up to 2^63 that is out of the range.
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return 0, false
+		}
+		return indexInt(v), true
+	}
+
+	return 0, false
+}
+
+func (config *IndexConfig) isInteger(propName string) bool {
+	return containsString(config.Integer, propName)
+}
+
+// AddIntegerIndex declares the property to be indexed with exact 64-bit integers and rebuilds the index
+// and the compound indexes that include the property.
+// Integer values of the property are indexed as ValueTypeInt64 instead of ValueTypeFloat64,
+// so that integers above 2^53 keep their precision.
+// The other numbers like 1.5 are indexed as ValueTypeFloat64, and a range filter doesn't match them with integer bounds.
+// ValueTypeFloat64 is ordered before ValueTypeInt64, so they are placed before all integers in the index order and SortBy.
+func (b *BaseBucket) AddIntegerIndex(propName string) error {
+	if propName == "" || isIgnorePattern(propName) {
+		return fmt.Errorf("invalid property name to index: %s", propName)
+	}
+
+	config, err := b.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	if config.isInteger(propName) {
+		return nil
+	}
+
+	if b.getIndexBucket(propName) != nil {
+		if err := b.deleteIndexBucket(propName); err != nil {
+			return err
+		}
+	}
+
+	if !config.isDeclared(propName) {
+		config.Properties = append(config.Properties, propName)
+	}
+	config.Integer = append(config.Integer, propName)
+	if err := b.putIndexConfig(config); err != nil {
+		return err
+	}
+
+	err = b.backfillIndex(func(n string) bool {
+		return n == propName
+	})
+	if err != nil {
+		return err
+	}
+
+	return b.rebuildCompoundIndexes(propName)
+}
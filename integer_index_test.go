@@ -0,0 +1,173 @@
+package bucketstore
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestToIndexInt(t *testing.T) {
+	cases := []struct {
+		value    interface{}
+		expected indexInt
+		ok       bool
+	}{
+		{1, 1, true},
+		{int64(-9223372036854775808), -9223372036854775808, true},
+		{uint64(9223372036854775808), 0, false},
+		{json.Number("9007199254740993"), 9007199254740993, true},
+		{json.Number("1e3"), 1000, true},
+		{json.Number("1.5"), 0, false},
+		{1.0, 1, true},
+		{1.5, 0, false},
+		{9223372036854775807.0, 0, false},
+		{"1", 0, false},
+	}
+
+	for i, c := range cases {
+		v, ok := toIndexInt(c.value)
+		if v != c.expected || ok != c.ok {
+			t.Errorf("unmatch case %d: %v %v", i, v, ok)
+		}
+	}
+
+	for _, v := range []int64{-9223372036854775808, -1, 0, 1, 9223372036854775807} {
+		if IndexBytesToInt64(Int64ToIndexBytes(v)) != v {
+			t.Errorf("unmatch: %d", v)
+		}
+	}
+}
+
+func TestBucketIntegerIndex(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	bucket := db.Bucket("users")
+	bucket.PutRaw([]byte("key1"), []byte(`{"id": 9007199254740992}`))
+	bucket.PutRaw([]byte("key2"), []byte(`{"id": 9007199254740993}`))
+	bucket.PutRaw([]byte("key3"), []byte(`{"id": 9007199254740994}`))
+	bucket.PutRaw([]byte("key4"), []byte(`{"id": 1.5}`))
+
+	// the precision isn't lost by reformatting.
+	if v, _ := bucket.GetRaw([]byte("key2")); string(v) != `{"id":9007199254740993}` {
+		t.Errorf("unmatch: %s", v)
+	}
+
+	// 9007199254740993 can't be represented by float64.
+	q := bucket.Query()
+	q.Filter = &PropValueMatchFilter{Property: "id", Match: json.Number("9007199254740993")}
+	if count, _ := q.Count(); count != 2 {
+		t.Errorf("should be 2: %d", count)
+	}
+
+	if err := bucket.AddIntegerIndex("id"); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	config, err := bucket.IndexConfig()
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if !config.isInteger("id") || !config.isDeclared("id") {
+		t.Errorf("should be declared: %v", config)
+	}
+
+	q = bucket.Query()
+	q.Filter = &PropValueMatchFilter{Property: "id", Match: json.Number("9007199254740993")}
+	items, err := q.AsList()
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if len(items) != 1 || string(items[0].Key) != "key2" {
+		t.Errorf("unmatch: %v", items)
+	}
+
+	q = bucket.Query()
+	q.Filter = &PropValueRangeFilter{Property: "id", Min: int64(9007199254740993), Max: int64(9007199254740994), OrderBy: OrderByDesc}
+	items, err = q.AsList()
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if len(items) != 2 || string(items[0].Key) != "key3" || string(items[1].Key) != "key2" {
+		t.Errorf("unmatch: %v", items)
+	}
+
+	// a non-integer number is indexed as float64.
+	q = bucket.Query()
+	q.Filter = &PropValueMatchFilter{Property: "id", Match: 1.5}
+	if count, _ := q.Count(); count != 1 {
+		t.Errorf("should be 1: %d", count)
+	}
+
+	// new items are indexed as integers.
+	bucket.PutRaw([]byte("key5"), []byte(`{"id": 9007199254740995}`))
+	q = bucket.Query()
+	q.Filter = &PropValueMatchFilter{Property: "id", Match: int64(9007199254740995)}
+	if count, _ := q.Count(); count != 1 {
+		t.Errorf("should be 1: %d", count)
+	}
+
+	// dropping the index rebuilds the float64 index in the all mode.
+	if err := bucket.DropIndex("id"); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	q = bucket.Query()
+	q.Filter = &PropValueMatchFilter{Property: "id", Match: 9007199254740992.0}
+	if count, _ := q.Count(); count != 2 {
+		t.Errorf("should be 2: %d", count)
+	}
+}
+
+func TestPreserveJSON(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	options := NewOptions()
+	options.PreserveJSON = true
+
+	db, err := Open(tmpFile.Name(), 0600, options)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	bucket := db.Bucket("users")
+	value := `{"name": "joe", "id": 9007199254740993, "age": 1.0}`
+	if err := bucket.PutRaw([]byte("key1"), []byte(value)); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	if v, _ := bucket.GetRaw([]byte("key1")); string(v) != value {
+		t.Errorf("unmatch: %s", v)
+	}
+
+	// the value is validated.
+	if err := bucket.PutRaw([]byte("key2"), []byte(`{"name": "joe"} {}`)); err == nil {
+		t.Errorf("should raise error")
+	}
+
+	q := bucket.Query()
+	q.Filter = &PropValueMatchFilter{Property: "age", Match: 1}
+	if count, _ := q.Count(); count != 1 {
+		t.Errorf("should be 1: %d", count)
+	}
+}
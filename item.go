@@ -1,6 +1,21 @@
 package bucketstore
 
+import (
+	"encoding/json"
+)
+
 type Item struct {
 	Key   []byte
 	Value []byte
+	// Revision is the revision of the item. It is set by Bucket.Get.
+	Revision uint64
+
+	// position is a position of the item in the cursor for the pagination token.
+	// If it is nil, the key is used as the position.
+	position []byte
+}
+
+// Decode unmarshals the value of the item into the value pointed to by out by encoding/json.
+func (item *Item) Decode(out interface{}) error {
+	return json.Unmarshal(item.Value, out)
 }
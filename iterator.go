@@ -0,0 +1,229 @@
+package bucketstore
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// errStopIteration is used to stop iterating items internally.
+var errStopIteration = errors.New("stop iteration")
+
+// Iterator walks items matching a query one by one.
+//
+//	it := bucket.Query().Iter()
+//	defer it.Close()
+//	for it.Next() {
+//	    item := it.Item()
+//	}
+//	if err := it.Err(); err != nil {
+//	    ...
+//	}
+//
+// The items are read from the bolt cursor in a goroutine that holds a read-only transaction.
+// You must call Close after using the iterator to release the transaction.
+// An iterator that is not closed is stopped when it is garbage collected or the database is closed,
+// and Err returns ErrDatabaseClosed in the latter case.
+// Don't start a write transaction in the same goroutine before closing the iterator,
+// because it may cause a deadlock when the database file is remapped.
+// If the query is for a bucket in a transaction, the items are read page by page in the caller's goroutine
+// because the transaction must not be used by other goroutines.
+type Iterator struct {
+	*iteration
+	// query is the rest of the query for a bucket in a transaction. It is nil after the last page.
+	query    *Query
+	page     []*Item
+	item     *Item
+	err      error
+	finished bool
+}
+
+// iteratorPageSize is the number of items read at once by an iterator for a bucket in a transaction.
+const iteratorPageSize = 100
+
+// iteration is the state shared with the goroutine of an iterator.
+// It is separated from Iterator so that the goroutine doesn't keep the abandoned iterator reachable.
+type iteration struct {
+	items    chan *Item
+	done     chan struct{}
+	errc     chan error
+	exited   chan struct{}
+	stopErr  error
+	stopOnce sync.Once
+}
+
+func newIterator(q *Query) *Iterator {
+	if q.bucket.baseBucket != nil {
+		rest := *q
+		return &Iterator{query: &rest}
+	}
+
+	iter := &iteration{
+		items:  make(chan *Item),
+		done:   make(chan struct{}),
+		errc:   make(chan error, 1),
+		exited: make(chan struct{}),
+	}
+
+	db := q.bucket.datastore
+	db.addIteration(iter)
+
+	go func() {
+		defer close(iter.exited)
+		defer db.removeIteration(iter)
+
+		err := q.ForEach(func(item *Item) error {
+			// copy the item because it is only valid in the transaction.
+			item = &Item{
+				Key:   append([]byte{}, item.Key...),
+				Value: append([]byte{}, item.Value...),
+			}
+
+			select {
+			case iter.items <- item:
+				return nil
+			case <-iter.done:
+				return errStopIteration
+			}
+		})
+		if err == errStopIteration {
+			err = iter.stopErr
+		}
+
+		iter.errc <- err
+		close(iter.items)
+	}()
+
+	it := &Iterator{iteration: iter}
+	runtime.SetFinalizer(it, func(it *Iterator) {
+		it.stop(nil)
+	})
+
+	return it
+}
+
+// stop makes the goroutine stop iterating. The err is returned by Err of the iterator.
+func (iter *iteration) stop(err error) {
+	iter.stopOnce.Do(func() {
+		iter.stopErr = err
+		close(iter.done)
+	})
+}
+
+// Next moves the iterator to the next item.
+// It returns false when there are no more items or an error occurred.
+func (it *Iterator) Next() bool {
+	if it.finished {
+		return false
+	}
+
+	if it.iteration == nil {
+		return it.nextInPage()
+	}
+
+	item, ok := <-it.items
+	if !ok {
+		it.finish()
+		return false
+	}
+
+	it.item = item
+	return true
+}
+
+// Item returns the current item.
+func (it *Iterator) Item() *Item {
+	return it.item
+}
+
+// Err returns the error that occurred while iterating.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Close stops iterating and releases the transaction.
+func (it *Iterator) Close() error {
+	if it.iteration == nil {
+		it.query = nil
+		it.page = nil
+		it.finished = true
+		it.item = nil
+		return it.err
+	}
+
+	it.stop(nil)
+
+	if !it.finished {
+		for range it.items {
+		}
+		it.finish()
+	}
+
+	it.item = nil
+	return it.err
+}
+
+func (it *Iterator) finish() {
+	it.err = <-it.errc
+	it.finished = true
+}
+
+// nextInPage moves the iterator for a bucket in a transaction to the next item of the page.
+func (it *Iterator) nextInPage() bool {
+	if len(it.page) == 0 {
+		it.readPage()
+	}
+
+	if len(it.page) == 0 {
+		it.finished = true
+		it.item = nil
+		return false
+	}
+
+	it.item = it.page[0]
+	it.page = it.page[1:]
+	return true
+}
+
+// readPage reads the next page of the query from the position of the last item of the previous page.
+func (it *Iterator) readPage() {
+	q := it.query
+	if q == nil {
+		return
+	}
+
+	pq := *q
+	pq.Limit = iteratorPageSize
+	if q.Limit != 0 && q.Limit < iteratorPageSize {
+		pq.Limit = q.Limit
+	}
+
+	page := []*Item{}
+	err := pq.ForEach(func(item *Item) error {
+		// copy the item because it is only valid until the transaction is modified.
+		page = append(page, &Item{
+			Key:   append([]byte{}, item.Key...),
+			Value: append([]byte{}, item.Value...),
+		})
+		return nil
+	})
+	if err != nil {
+		it.err = err
+		it.query = nil
+		return
+	}
+
+	it.page = page
+
+	if uint64(len(page)) < pq.Limit || (q.Limit != 0 && q.Limit == uint64(len(page))) {
+		it.query = nil
+		return
+	}
+
+	// the offset has been skipped by the first page.
+	q.Offset = 0
+	q.After = pq.Token()
+	if q.Limit != 0 {
+		q.Limit -= uint64(len(page))
+	}
+}
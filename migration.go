@@ -0,0 +1,243 @@
+package bucketstore
+
+import (
+	"fmt"
+	"github.com/kohkimakimoto/bucketstore/v/bolt"
+)
+
+const (
+	// indexVersion is a version of the index key format.
+	// It is incremented when the index format is changed.
+	//
+	//   0: initial format.
+	//   1: numbers are stored as order-preserving bytes.
+	//   2: nested properties are indexed by dotted paths.
+	//   3: each element of arrays is indexed.
+	//   4: revisions of items are stored.
+	//   5: index values of array properties have the other values of the items.
+	//   6: case-insensitive collations fold the case of strings instead of lowering it.
+	indexVersion uint64 = 6
+)
+
+var keyIndexVersion = []byte("index_version")
+
+// migrate upgrades the index format of the database to the current version.
+func migrate(tx *bolt.Tx) error {
+	meta := tx.Bucket(bMetadata)
+
+	version := getIndexVersion(tx)
+	if version > indexVersion {
+		return fmt.Errorf("unsupported index version %d. the database was created by newer version.", version)
+	}
+
+	if version < 1 {
+		if err := migrateFloat64IndexKeys(tx); err != nil {
+			return err
+		}
+	}
+
+	// the index of all items is rewritten by the current format.
+	if version < 5 {
+		if err := migrateItemsIndex(tx); err != nil {
+			return err
+		}
+	}
+
+	if version < 4 {
+		if err := migrateRevisions(tx); err != nil {
+			return err
+		}
+	}
+
+	if version < 6 {
+		if err := migrateCaseFolding(tx); err != nil {
+			return err
+		}
+	}
+
+	return meta.Put(keyIndexVersion, Uint64ToBytes(indexVersion))
+}
+
+// checkIndexVersion checks the index format of the database in the read only mode.
+// The database of an older version can be read, but the queries reading the indexes fail.
+func (db *DB) checkIndexVersion(tx *bolt.Tx) error {
+	version := getIndexVersion(tx)
+	if version > indexVersion {
+		return fmt.Errorf("unsupported index version %d. the database was created by newer version.", version)
+	}
+
+	db.indexVersion = version
+	return nil
+}
+
+// checkIndexReadable returns an error if the indexes of the bucket can't be read,
+// because they are in an older format or are being rebuilt.
+func (b *BaseBucket) checkIndexReadable() error {
+	// the transaction of the migration doesn't have the database.
+	if b.tx.db == nil {
+		return nil
+	}
+
+	if version := b.tx.db.indexVersion; version != indexVersion {
+		return fmt.Errorf("the indexes of index version %d are not supported in the read only mode. open the database once in the writable mode to migrate it.", version)
+	}
+
+	return b.checkNotRebuilding()
+}
+
+func getIndexVersion(tx *bolt.Tx) uint64 {
+	meta := tx.Bucket(bMetadata)
+	if meta == nil {
+		return 0
+	}
+
+	v := meta.Get(keyIndexVersion)
+	if v == nil {
+		return 0
+	}
+
+	return BytesToUint64(v)
+}
+
+// migrateFloat64IndexKeys rebuilds index keys of numbers
+// from raw float64 bits to order-preserving bytes.
+func migrateFloat64IndexKeys(tx *bolt.Tx) error {
+	index := tx.Bucket(bIndex)
+
+	return tx.Bucket(bBucketsList).ForEach(func(name, _ []byte) error {
+		propsBucket := index.Bucket(name)
+		if propsBucket == nil {
+			return nil
+		}
+
+		return propsBucket.ForEach(func(propName, v []byte) error {
+			if v != nil {
+				// not a bucket.
+				return nil
+			}
+
+			return migrateFloat64IndexBucket(propsBucket.Bucket(propName))
+		})
+	})
+}
+
+func migrateFloat64IndexBucket(indexBucket *bolt.Bucket) error {
+	type entry struct {
+		key []byte
+		ref []byte
+	}
+
+	// collect the keys at first because the bucket must not be modified while iterating.
+	entries := []*entry{}
+	c := indexBucket.Cursor()
+	prefix := []byte{ValueTypeFloat64}
+	for k, v := c.Seek(prefix); k != nil && k[0] == ValueTypeFloat64; k, v = c.Next() {
+		if len(k) < 9 {
+			return fmt.Errorf("got a illegal formatted key %v", k)
+		}
+
+		entries = append(entries, &entry{
+			key: append([]byte{}, k...),
+			ref: append([]byte{}, v...),
+		})
+	}
+
+	for _, e := range entries {
+		if err := indexBucket.Delete(e.key); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range entries {
+		newKey := append([]byte{}, e.key...)
+		copy(newKey[1:9], Float64ToIndexBytes(BytesToFloat64(e.key[1:9])))
+
+		if err := indexBucket.Put(newKey, e.ref); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateItemsIndex creates index of nested properties and array elements
+// for the items that were stored before supporting them, and rewrites the index values of array properties.
+func migrateItemsIndex(tx *bolt.Tx) error {
+	t := newTx(nil, tx)
+
+	return t.bBucketsList().ForEach(func(name, _ []byte) error {
+		b, err := t.baseBucket(name)
+		if err != nil {
+			return err
+		}
+
+		if b == nil {
+			return nil
+		}
+
+		return b.backfillIndex(nil)
+	})
+}
+
+// migrateCaseFolding rebuilds the indexes of the properties that have case-insensitive collations,
+// because their index keys were lowered strings.
+func migrateCaseFolding(tx *bolt.Tx) error {
+	t := newTx(nil, tx)
+
+	return t.bBucketsList().ForEach(func(name, _ []byte) error {
+		b, err := t.baseBucket(name)
+		if err != nil {
+			return err
+		}
+
+		if b == nil {
+			return nil
+		}
+
+		config, err := b.IndexConfig()
+		if err != nil {
+			return err
+		}
+
+		// collect the properties at first because SetCollation modifies the configuration.
+		collations := map[string]*Collation{}
+		for n, c := range config.Collations {
+			if c.CaseInsensitive {
+				collations[n] = c
+			}
+		}
+
+		for n, c := range collations {
+			if err := b.SetCollation(n, c); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// migrateRevisions stores the first revision of the items that were stored before supporting revisions.
+func migrateRevisions(tx *bolt.Tx) error {
+	revisions := tx.Bucket(bRevisions)
+
+	return tx.Bucket(bBucketsList).ForEach(func(name, _ []byte) error {
+		data := tx.Bucket(bData).Bucket(name)
+		if data == nil {
+			return nil
+		}
+
+		bucket, err := revisions.CreateBucketIfNotExists(name)
+		if err != nil {
+			return err
+		}
+
+		return data.ForEach(func(key, _ []byte) error {
+			if bucket.Get(key) != nil {
+				return nil
+			}
+
+			return bucket.Put(key, Uint64ToBytes(1))
+		})
+	})
+}
@@ -0,0 +1,331 @@
+package bucketstore
+
+import (
+	"encoding/binary"
+	"github.com/kohkimakimoto/bucketstore/v/bolt"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestMigrateFloat64IndexKeys(t *testing.T) {
+	// setup database
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	// create a database that has the index keys by the initial format.
+	conn, err := bolt.Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+
+	err = conn.Update(func(tx *bolt.Tx) error {
+		data, _ := tx.CreateBucketIfNotExists(bData)
+		index, _ := tx.CreateBucketIfNotExists(bIndex)
+		list, _ := tx.CreateBucketIfNotExists(bBucketsList)
+
+		d, _ := data.CreateBucket([]byte("test_bucket"))
+		i, _ := index.CreateBucket([]byte("test_bucket"))
+		list.Put([]byte("test_bucket"), []byte("e"))
+		prop, _ := i.CreateBucket([]byte("num"))
+
+		for n, v := range []float64{-10, 5, 10} {
+			key := []byte{byte('a' + n)}
+			d.Put(key, []byte(`{}`))
+
+			b := make([]byte, 8)
+			binary.BigEndian.PutUint64(b, math.Float64bits(v))
+			prop.Put(append(append(append([]byte{ValueTypeFloat64}, b...), sep1, sep2), key...), key)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	conn.Close()
+
+	ds, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer ds.Close()
+
+	q := ds.Bucket("test_bucket").Query()
+	q.Filter = &PropValueRangeFilter{
+		Property: "num",
+		Min:      -20,
+		Max:      7,
+	}
+
+	items, err := q.AsList()
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	if len(items) != 2 {
+		t.Fatalf("invalid count: %d", len(items))
+	}
+
+	if string(items[0].Key) != "a" || string(items[1].Key) != "b" {
+		t.Errorf("unmatch: %s %s", string(items[0].Key), string(items[1].Key))
+	}
+
+	ds.View(func(tx *Tx) error {
+		if v := getIndexVersion(tx.InternalTx()); v != indexVersion {
+			t.Errorf("invalid index version: %d", v)
+		}
+		return nil
+	})
+}
+
+func TestMigrateRevisions(t *testing.T) {
+	// setup database
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	// create a database that has the items stored before supporting revisions.
+	conn, err := bolt.Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+
+	err = conn.Update(func(tx *bolt.Tx) error {
+		data, _ := tx.CreateBucketIfNotExists(bData)
+		index, _ := tx.CreateBucketIfNotExists(bIndex)
+		list, _ := tx.CreateBucketIfNotExists(bBucketsList)
+		meta, _ := tx.CreateBucketIfNotExists(bMetadata)
+
+		d, _ := data.CreateBucket([]byte("test_bucket"))
+		index.CreateBucket([]byte("test_bucket"))
+		list.Put([]byte("test_bucket"), []byte("e"))
+		meta.Put(keyIndexVersion, Uint64ToBytes(3))
+
+		d.Put([]byte("a"), []byte(`{}`))
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	conn.Close()
+
+	ds, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer ds.Close()
+
+	item, err := ds.Bucket("test_bucket").Get([]byte("a"))
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if item.Revision != 1 {
+		t.Errorf("should be 1: %d", item.Revision)
+	}
+}
+
+func TestMigrateArrayIndexValues(t *testing.T) {
+	// setup database
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	// create a database that has the index values of arrays without the other values.
+	conn, err := bolt.Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+
+	err = conn.Update(func(tx *bolt.Tx) error {
+		data, _ := tx.CreateBucketIfNotExists(bData)
+		index, _ := tx.CreateBucketIfNotExists(bIndex)
+		list, _ := tx.CreateBucketIfNotExists(bBucketsList)
+		meta, _ := tx.CreateBucketIfNotExists(bMetadata)
+
+		d, _ := data.CreateBucket([]byte("test_bucket"))
+		i, _ := index.CreateBucket([]byte("test_bucket"))
+		list.Put([]byte("test_bucket"), []byte("e"))
+		meta.Put(keyIndexVersion, Uint64ToBytes(4))
+		prop, _ := i.CreateBucket([]byte("tags"))
+
+		d.Put([]byte("a"), []byte(`{"tags":["x","y"]}`))
+		prop.Put(genIndexKey("x", []byte("a")), []byte("a"))
+		prop.Put(genIndexKey("y", []byte("a")), []byte("a"))
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	conn.Close()
+
+	ds, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer ds.Close()
+
+	q := ds.Bucket("test_bucket").Query()
+	q.Filter = &PropValuePrefixFilter{Property: "tags", Prefix: ""}
+	if count, _ := q.Count(); count != 1 {
+		t.Errorf("should be 1: %d", count)
+	}
+
+	report, err := ds.CheckIndexes("test_bucket")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("should be ok: %v", report)
+	}
+}
+
+func TestMigrateCaseFolding(t *testing.T) {
+	// setup database
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	// create a database that has the lowered index keys of the case-insensitive collation.
+	conn, err := bolt.Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+
+	err = conn.Update(func(tx *bolt.Tx) error {
+		data, _ := tx.CreateBucketIfNotExists(bData)
+		index, _ := tx.CreateBucketIfNotExists(bIndex)
+		list, _ := tx.CreateBucketIfNotExists(bBucketsList)
+		config, _ := tx.CreateBucketIfNotExists(bIndexConfig)
+		meta, _ := tx.CreateBucketIfNotExists(bMetadata)
+
+		d, _ := data.CreateBucket([]byte("test_bucket"))
+		i, _ := index.CreateBucket([]byte("test_bucket"))
+		list.Put([]byte("test_bucket"), []byte("e"))
+		config.Put([]byte("test_bucket"), []byte(`{"mode":"all","collations":{"street":{"case_insensitive":true}}}`))
+		meta.Put(keyIndexVersion, Uint64ToBytes(5))
+		prop, _ := i.CreateBucket([]byte("street"))
+
+		d.Put([]byte("a"), []byte(`{"street":"Straße"}`))
+		prop.Put(genIndexKey("straße", []byte("a")), []byte("a"))
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	conn.Close()
+
+	ds, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer ds.Close()
+
+	q := ds.Bucket("test_bucket").Query()
+	q.Filter = &PropValueMatchFilter{Property: "street", Match: "STRASSE"}
+	if count, _ := q.Count(); count != 1 {
+		t.Errorf("should be 1: %d", count)
+	}
+
+	report, err := ds.CheckIndexes("test_bucket")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("should be ok: %v", report)
+	}
+}
+
+func TestReadOnlyOldIndexVersion(t *testing.T) {
+	// setup database
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	// create a database of the index version 4.
+	conn, err := bolt.Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+
+	err = conn.Update(func(tx *bolt.Tx) error {
+		data, _ := tx.CreateBucketIfNotExists(bData)
+		index, _ := tx.CreateBucketIfNotExists(bIndex)
+		list, _ := tx.CreateBucketIfNotExists(bBucketsList)
+		meta, _ := tx.CreateBucketIfNotExists(bMetadata)
+
+		d, _ := data.CreateBucket([]byte("test_bucket"))
+		i, _ := index.CreateBucket([]byte("test_bucket"))
+		list.Put([]byte("test_bucket"), []byte("e"))
+		meta.Put(keyIndexVersion, Uint64ToBytes(4))
+		prop, _ := i.CreateBucket([]byte("age"))
+
+		d.Put([]byte("a"), []byte(`{"age":5}`))
+		d.Put([]byte("b"), []byte(`{"age":3}`))
+		prop.Put(genIndexKey(5.0, []byte("a")), []byte("a"))
+		prop.Put(genIndexKey(3.0, []byte("b")), []byte("b"))
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	conn.Close()
+
+	options := NewOptions()
+	options.ReadOnly = true
+	ds, err := Open(tmpFile.Name(), 0600, options)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer ds.Close()
+
+	bucket := ds.Bucket("test_bucket")
+
+	// the queries that don't read the indexes work.
+	q := bucket.Query()
+	q.SortBy = []SortKey{{Property: "age", OrderBy: OrderByAsc}}
+	items, err := q.AsList()
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if len(items) != 2 || string(items[0].Key) != "b" {
+		t.Errorf("unmatch: %v", items)
+	}
+
+	q = bucket.Query()
+	q.Filter = &PropValueMatchFilter{Property: "age", Match: 5}
+	if _, err := q.AsList(); err == nil {
+		t.Errorf("should raise error")
+	}
+}
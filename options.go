@@ -2,15 +2,39 @@ package bucketstore
 
 import (
 	"github.com/kohkimakimoto/bucketstore/v/bolt"
+	"time"
 )
 
 type Options struct {
 	*bolt.Options
+
+	// PreserveJSON stores JSON values as they are after validating them.
+	// By default, they are reformatted and the properties of objects are sorted by their names.
+	PreserveJSON bool
+
+	// ReaperInterval is the interval to delete expired items in the background.
+	// If it is 0, the reaper doesn't run, and expired items are deleted by DB.ReapExpired.
+	ReaperInterval time.Duration
+	// ReaperBatchSize is the number of expired items deleted in a write transaction.
+	// If it is 0, 1000 is used.
+	ReaperBatchSize int
+
+	// RebuildBatchSize is the number of items indexed in a write transaction by DB.RebuildIndexes.
+	// If it is 0, 1000 is used.
+	RebuildBatchSize int
+
+	// ChangeLog writes the change log of items to watch them by DB.Watch.
+	ChangeLog bool
+	// ChangeLogRetention is the number of the latest events kept in the change log.
+	// If it is 0, all events are kept.
+	ChangeLogRetention uint64
 }
 
 func NewOptions() *Options {
 	opt := &Options{}
-	opt.Options = bolt.DefaultOptions
+	// copy the default options not to modify them by setting the options like ReadOnly.
+	boltOptions := *bolt.DefaultOptions
+	opt.Options = &boltOptions
 
 	return opt
 }
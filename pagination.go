@@ -0,0 +1,151 @@
+package bucketstore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/kohkimakimoto/bucketstore/v/bolt"
+)
+
+//
+// # Pagination token specification.
+//
+// A token is a position of the last item found by a query, that is encoded by base64 (URL encoding without padding).
+//
+//   <positionType> + <position>
+//
+// positionType:
+//   'k': the position is a key of the item in the data bucket.
+//   'i': the position is an index key in the index bucket.
+//   's': the position is sort values and a key of the item sorted in memory.
+//   'r': the position is a score and a key of the item ranked by a text search.
+//
+// A query given the token seeks directly to the position by the cursor,
+// and starts to find items from the next position.
+//
+
+const (
+	positionTypeKey    = 'k'
+	positionTypeIndex  = 'i'
+	positionTypeSorted = 's'
+	positionTypeRanked = 'r'
+)
+
+// position is a decoded pagination token.
+type position struct {
+	positionType byte
+	key          []byte
+}
+
+func encodeToken(p []byte) string {
+	return base64.RawURLEncoding.EncodeToString(p)
+}
+
+func decodeToken(token string) (*position, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %v", err)
+	}
+
+	if len(b) < 2 {
+		return nil, fmt.Errorf("invalid token: %s", token)
+	}
+
+	switch b[0] {
+	case positionTypeKey, positionTypeIndex, positionTypeSorted, positionTypeRanked:
+		return &position{positionType: b[0], key: b[1:]}, nil
+	}
+
+	return nil, fmt.Errorf("invalid token: %s", token)
+}
+
+func keyPosition(key []byte) []byte {
+	return append([]byte{positionTypeKey}, key...)
+}
+
+func indexPosition(indexKey []byte) []byte {
+	return append([]byte{positionTypeIndex}, indexKey...)
+}
+
+// afterPosition gets the position to resume from the query.
+// It returns nil if the query doesn't have a token.
+func (q *Query) afterPosition(positionType byte) ([]byte, error) {
+	if q.after == nil {
+		return nil, nil
+	}
+
+	if q.after.positionType != positionType {
+		return nil, fmt.Errorf("the token is not for this query")
+	}
+
+	return q.after.key, nil
+}
+
+// seekAfter moves the cursor to the next position of the key in the order.
+func seekAfter(c *bolt.Cursor, key []byte, order OrderBy) ([]byte, []byte) {
+	k, v := c.Seek(key)
+	if order == OrderByDesc {
+		if k == nil {
+			return c.Last()
+		}
+		return c.Prev()
+	}
+
+	if k != nil && bytes.Equal(k, key) {
+		return c.Next()
+	}
+	return k, v
+}
+
+// beginCursor gets the first position of the cursor to iterate.
+// If the position to resume is specified, it moves to the next of the position.
+// Otherwise it moves by the begin function.
+func beginCursor(c *bolt.Cursor, after []byte, order OrderBy, begin func() ([]byte, []byte)) ([]byte, []byte) {
+	if after != nil {
+		return seekAfter(c, after, order)
+	}
+
+	return begin()
+}
+
+// beginIndexCursor gets the first position of the index cursor to iterate.
+// If the position to resume is specified, it moves to the next of the position.
+// Otherwise it moves by the begin function.
+func beginIndexCursor(ic *IndexCursor, after []byte, order OrderBy, begin func() *Index) *Index {
+	if after == nil {
+		return begin()
+	}
+
+	if ic.cursor == nil {
+		return nil
+	}
+
+	k, v := seekAfter(ic.cursor, after, order)
+	if k == nil {
+		return nil
+	}
+
+	return newIndex(ic.bucket, k, v)
+}
+
+// foundBefore checks whether the item that the index refers has been found before the index
+// by another value of the array property in the order. It is used to avoid duplicated items
+// in a scan and across pages without remembering the found items.
+// The values of the item matching the filter are contiguous in the index,
+// so it checks only the previous or the next value of the item stored in the index without reading the item.
+func foundBefore(idx *Index, order OrderBy, match func(valueType byte, value []byte) bool) bool {
+	neighbor := idx.prev
+	if order == OrderByDesc {
+		neighbor = idx.next
+	}
+
+	if len(neighbor) == 0 {
+		return false
+	}
+
+	return match(neighbor[0], neighbor[1:])
+}
@@ -0,0 +1,116 @@
+package bucketstore
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestQueryPagination(t *testing.T) {
+	// setup database
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	ds, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer ds.Close()
+
+	bucket := ds.Bucket("zoo")
+	bucket.PutRaw([]byte("key1"), []byte(`{"name": "joe", "class": "lion", "age": 5, "tags": [1, 3]}`))
+	bucket.PutRaw([]byte("key2"), []byte(`{"name": "foo", "class": "lion", "age": 13, "tags": [2]}`))
+	bucket.PutRaw([]byte("key3"), []byte(`{"name": "coo", "class": "tiger", "age": 6, "tags": [4, 1]}`))
+	bucket.PutRaw([]byte("key4"), []byte(`{"name": "tony", "class": "horse", "tags": [5, 2, 6]}`))
+	bucket.PutRaw([]byte("key5"), []byte(`{"name": "leo", "class": "lion", "age": 3}`))
+	bucket.PutRaw([]byte("key6"), []byte(`{"name": "bob", "class": "lion", "age": 5, "tags": [3]}`))
+
+	filters := map[string]func(order OrderBy) Filter{
+		"orderBy":   func(order OrderBy) Filter { return &OrderByFilter{OrderBy: order} },
+		"keyPrefix": func(order OrderBy) Filter { return &KeyPrefixFilter{Prefix: []byte("key"), OrderBy: order} },
+		"keyRange":  func(order OrderBy) Filter { return &KeyRangeFilter{Min: []byte("key2"), Max: []byte("key5"), OrderBy: order} },
+		"match":     func(order OrderBy) Filter { return &PropValueMatchFilter{Property: "class", Match: "lion", OrderBy: order} },
+		"prefix":    func(order OrderBy) Filter { return &PropValuePrefixFilter{Property: "name", Prefix: "", OrderBy: order} },
+		"range":     func(order OrderBy) Filter { return &PropValueRangeFilter{Property: "tags", Min: 1, Max: 5, OrderBy: order} },
+		"and": func(order OrderBy) Filter {
+			return &AndFilter{Filters: []Filter{&PropValueMatchFilter{Property: "class", Match: "lion"}, &PropValueRangeFilter{Property: "age", Min: 0, Max: 10}}, OrderBy: order}
+		},
+		"or": func(order OrderBy) Filter {
+			return &OrFilter{Filters: []Filter{&PropValueMatchFilter{Property: "class", Match: "tiger"}, &PropValueMatchFilter{Property: "class", Match: "horse"}}, OrderBy: order}
+		},
+		"not": func(order OrderBy) Filter {
+			return &NotFilter{Filter: &PropValueMatchFilter{Property: "class", Match: "tiger"}, OrderBy: order}
+		},
+	}
+
+	sortBys := map[string][]SortKey{
+		"none":      nil,
+		"age":       {{Property: "age"}},
+		"age desc":  {{Property: "age", OrderBy: OrderByDesc}},
+		"tags desc": {{Property: "tags", OrderBy: OrderByDesc}},
+		"multi":     {{Property: "class"}, {Property: "age", OrderBy: OrderByDesc}},
+	}
+
+	for name, newFilter := range filters {
+		for _, order := range []OrderBy{OrderByAsc, OrderByDesc} {
+			for sortName, sortBy := range sortBys {
+				if sortBy != nil && name != "orderBy" && name != "range" && name != "match" {
+					continue
+				}
+
+				q := bucket.Query()
+				q.Filter = newFilter(order)
+				q.SortBy = sortBy
+				all, err := q.AsList()
+				if err != nil {
+					t.Fatalf("should not raise error: %v", err)
+				}
+				expected := []string{}
+				for _, item := range all {
+					expected = append(expected, string(item.Key))
+				}
+
+				for _, limit := range []uint64{1, 2, 4} {
+					keys := []string{}
+					token := ""
+					for i := 0; i < 10; i++ {
+						q := bucket.Query()
+						q.Filter = newFilter(order)
+						q.SortBy = sortBy
+						q.Limit = limit
+						q.After = token
+						items, err := q.AsList()
+						if err != nil {
+							t.Fatalf("should not raise error %s order=%d sort=%s limit=%d: %v", name, order, sortName, limit, err)
+						}
+						if len(items) == 0 {
+							break
+						}
+						for _, item := range items {
+							keys = append(keys, string(item.Key))
+						}
+						token = q.Token()
+					}
+
+					if strings.Join(keys, ",") != strings.Join(expected, ",") {
+						t.Errorf("unmatch %s order=%d sort=%s limit=%d: %v (expected %v)", name, order, sortName, limit, keys, expected)
+					}
+				}
+			}
+		}
+	}
+
+	// invalid token
+	q := bucket.Query()
+	q.After = "!!!"
+	if _, err := q.AsList(); err == nil {
+		t.Errorf("should raise error")
+	}
+}
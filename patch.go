@@ -0,0 +1,421 @@
+package bucketstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Patch partially updates the item by the patch.
+// The patch is a JSON Patch (RFC 6902) if it is a JSON array,
+// and is a JSON Merge Patch (RFC 7396) if it is a JSON object.
+// If any operation of the JSON Patch fails, the item isn't changed.
+func (b *BaseBucket) Patch(key []byte, patch []byte) error {
+	if b.ValueMode() == ValueModeRaw {
+		return fmt.Errorf("the bucket in the raw mode can't be patched")
+	}
+
+	value := b.Get(key)
+	if value == nil {
+		return fmt.Errorf("the item %q doesn't exist", string(key))
+	}
+
+	var doc interface{}
+	if err := decodeJSON(value, &doc); err != nil {
+		return fmt.Errorf("invalid json formatted data: %v", err)
+	}
+
+	var p interface{}
+	if err := decodeJSON(patch, &p); err != nil {
+		return fmt.Errorf("invalid patch: %v", err)
+	}
+
+	var err error
+	switch ops := p.(type) {
+	case []interface{}:
+		doc, err = applyJSONPatch(doc, ops)
+		if err != nil {
+			return err
+		}
+	case map[string]interface{}:
+		doc = applyMergePatch(doc, ops)
+	default:
+		return fmt.Errorf("invalid patch: the patch must be a JSON array or a JSON object")
+	}
+
+	patched, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	// patching keeps the expiry of the item.
+	expiresAt, expiring := b.ExpiresAt(key)
+
+	if err := b.Put(key, patched); err != nil {
+		return err
+	}
+
+	if expiring {
+		return b.setExpiry(key, expiresAt)
+	}
+
+	return nil
+}
+
+// applyMergePatch applies the JSON Merge Patch (RFC 7396) to the document.
+func applyMergePatch(doc interface{}, patch interface{}) interface{} {
+	patchMap, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	docMap, ok := doc.(map[string]interface{})
+	if !ok {
+		docMap = map[string]interface{}{}
+	}
+
+	for n, v := range patchMap {
+		if v == nil {
+			delete(docMap, n)
+			continue
+		}
+
+		docMap[n] = applyMergePatch(docMap[n], v)
+	}
+
+	return docMap
+}
+
+// applyJSONPatch applies the operations of the JSON Patch (RFC 6902) to the document.
+func applyJSONPatch(doc interface{}, ops []interface{}) (interface{}, error) {
+	for i, o := range ops {
+		op, ok := o.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid patch: the operation %d must be a JSON object", i)
+		}
+
+		name, _ := op["op"].(string)
+		path, ok := op["path"].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid patch: the operation %d doesn't have the path", i)
+		}
+
+		var err error
+		switch name {
+		case "add":
+			value, ok := op["value"]
+			if !ok {
+				return nil, fmt.Errorf("invalid patch: the operation %d doesn't have the value", i)
+			}
+			doc, err = jsonPointerAdd(doc, path, value)
+		case "remove":
+			doc, _, err = jsonPointerRemove(doc, path)
+		case "replace":
+			value, ok := op["value"]
+			if !ok {
+				return nil, fmt.Errorf("invalid patch: the operation %d doesn't have the value", i)
+			}
+			doc, _, err = jsonPointerRemove(doc, path)
+			if err == nil {
+				doc, err = jsonPointerAdd(doc, path, value)
+			}
+		case "move", "copy":
+			from, ok := op["from"].(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid patch: the operation %d doesn't have the from", i)
+			}
+			if name == "move" && strings.HasPrefix(path+"/", from+"/") && path != from {
+				return nil, fmt.Errorf("patch failed: the operation %d moves %s into its child", i, from)
+			}
+
+			var value interface{}
+			if name == "move" {
+				doc, value, err = jsonPointerRemove(doc, from)
+			} else {
+				value, err = jsonPointerGet(doc, from)
+				// the copied value must not share the containers with the source.
+				value = copyJSONValue(value)
+			}
+			if err == nil {
+				doc, err = jsonPointerAdd(doc, path, value)
+			}
+		case "test":
+			var actual interface{}
+			actual, err = jsonPointerGet(doc, path)
+			if err == nil && !jsonValueEqual(actual, op["value"]) {
+				err = fmt.Errorf("the value of %s is not equal to the value of the test", path)
+			}
+		default:
+			return nil, fmt.Errorf("invalid patch: unsupported operation %q of the operation %d", name, i)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("patch failed: the operation %d: %v", i, err)
+		}
+	}
+
+	return doc, nil
+}
+
+// parseJSONPointer parses the JSON Pointer (RFC 6901) to the reference tokens.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid json pointer: %s", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(t, "~1", "/", -1), "~0", "~", -1)
+	}
+
+	return tokens, nil
+}
+
+// arrayIndex parses the reference token to the index of the array.
+// If the end is true, "-" is the index after the last element.
+func arrayIndex(token string, length int, end bool) (int, error) {
+	if end && token == "-" {
+		return length, nil
+	}
+
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index: %s", token)
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid array index: %s", token)
+	}
+
+	limit := length - 1
+	if end {
+		limit = length
+	}
+	if i > limit {
+		return 0, fmt.Errorf("the array index %d is out of range", i)
+	}
+
+	return i, nil
+}
+
+func jsonPointerGet(doc interface{}, pointer string) (interface{}, error) {
+	tokens, err := parseJSONPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	v := doc
+	for _, t := range tokens {
+		switch container := v.(type) {
+		case map[string]interface{}:
+			child, ok := container[t]
+			if !ok {
+				return nil, fmt.Errorf("the path %s doesn't exist", pointer)
+			}
+			v = child
+		case []interface{}:
+			i, err := arrayIndex(t, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			v = container[i]
+		default:
+			return nil, fmt.Errorf("the path %s doesn't exist", pointer)
+		}
+	}
+
+	return v, nil
+}
+
+// jsonPointerAdd adds the value at the pointer and returns the new document.
+func jsonPointerAdd(doc interface{}, pointer string, value interface{}) (interface{}, error) {
+	tokens, err := parseJSONPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		// replaces the whole document.
+		return value, nil
+	}
+
+	parent, err := jsonPointerGet(doc, pointerOf(tokens[:len(tokens)-1]))
+	if err != nil {
+		return nil, err
+	}
+
+	last := tokens[len(tokens)-1]
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		container[last] = value
+		return doc, nil
+	case []interface{}:
+		i, err := arrayIndex(last, len(container), true)
+		if err != nil {
+			return nil, err
+		}
+
+		container = append(container, nil)
+		copy(container[i+1:], container[i:])
+		container[i] = value
+		return replaceJSONValue(doc, tokens[:len(tokens)-1], container), nil
+	}
+
+	return nil, fmt.Errorf("the path %s doesn't exist", pointer)
+}
+
+// jsonPointerRemove removes the value at the pointer and returns the new document and the removed value.
+func jsonPointerRemove(doc interface{}, pointer string) (interface{}, interface{}, error) {
+	tokens, err := parseJSONPointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, doc, nil
+	}
+
+	parent, err := jsonPointerGet(doc, pointerOf(tokens[:len(tokens)-1]))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	last := tokens[len(tokens)-1]
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		v, ok := container[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("the path %s doesn't exist", pointer)
+		}
+		delete(container, last)
+		return doc, v, nil
+	case []interface{}:
+		i, err := arrayIndex(last, len(container), false)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		v := container[i]
+		container = append(container[:i], container[i+1:]...)
+		return replaceJSONValue(doc, tokens[:len(tokens)-1], container), v, nil
+	}
+
+	return nil, nil, fmt.Errorf("the path %s doesn't exist", pointer)
+}
+
+// replaceJSONValue replaces the value at the reference tokens that must exist.
+// It is used to replace an array whose length is changed.
+func replaceJSONValue(doc interface{}, tokens []string, value interface{}) interface{} {
+	if len(tokens) == 0 {
+		return value
+	}
+
+	parent, _ := jsonPointerGet(doc, pointerOf(tokens[:len(tokens)-1]))
+	last := tokens[len(tokens)-1]
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		container[last] = value
+	case []interface{}:
+		i, _ := strconv.Atoi(last)
+		container[i] = value
+	}
+
+	return doc
+}
+
+func pointerOf(tokens []string) string {
+	var buf bytes.Buffer
+	for _, t := range tokens {
+		buf.WriteString("/")
+		buf.WriteString(strings.Replace(strings.Replace(t, "~", "~0", -1), "/", "~1", -1))
+	}
+
+	return buf.String()
+}
+
+func copyJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for n, child := range v {
+			m[n] = copyJSONValue(child)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, child := range v {
+			a[i] = copyJSONValue(child)
+		}
+		return a
+	}
+
+	return value
+}
+
+// jsonValueEqual compares the JSON values. Numbers are compared by their values, not by their literals.
+func jsonValueEqual(a, b interface{}) bool {
+	an, aok := a.(json.Number)
+	bn, bok := b.(json.Number)
+	if aok && bok {
+		if an == bn {
+			return true
+		}
+
+		af, aerr := an.Float64()
+		bf, berr := bn.Float64()
+		return aerr == nil && berr == nil && af == bf
+	}
+
+	// the values parsed by json.Unmarshal like the enum of a schema have float64 numbers.
+	if af, ok := jsonFloat64(a); ok {
+		bf, ok := jsonFloat64(b)
+		return ok && af == bf
+	}
+
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for n, v := range av {
+			if w, ok := bv[n]; !ok || !jsonValueEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonValueEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+// jsonFloat64 gets the float64 of the number decoded as json.Number or float64.
+func jsonFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,141 @@
+package bucketstore
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestApplyPatch(t *testing.T) {
+	cases := []struct {
+		doc      string
+		patch    string
+		expected string
+	}{
+		// JSON Merge Patch (RFC 7396)
+		{`{"a": "b", "c": {"d": "e", "f": "g"}}`, `{"a": "z", "c": {"f": null}}`, `{"a":"z","c":{"d":"e"}}`},
+		{`{"a": [1, 2]}`, `{"a": [3], "b": {"c": 1}}`, `{"a":[3],"b":{"c":1}}`},
+		{`{"a": 9007199254740993}`, `{"b": 1}`, `{"a":9007199254740993,"b":1}`},
+		// JSON Patch (RFC 6902)
+		{`{"a": 1}`, `[{"op": "add", "path": "/b", "value": [1, 2]}]`, `{"a":1,"b":[1,2]}`},
+		{`{"a": [1, 2]}`, `[{"op": "add", "path": "/a/1", "value": 3}, {"op": "add", "path": "/a/-", "value": 4}]`, `{"a":[1,3,2,4]}`},
+		{`{"a": [1, 2, 3]}`, `[{"op": "remove", "path": "/a/0"}]`, `{"a":[2,3]}`},
+		{`{"a": {"b": 1}}`, `[{"op": "replace", "path": "/a/b", "value": "x"}]`, `{"a":{"b":"x"}}`},
+		{`{"a": {"b": 1}, "c": []}`, `[{"op": "move", "from": "/a/b", "path": "/c/0"}]`, `{"a":{},"c":[1]}`},
+		{`{"a": {"b": 1}}`, `[{"op": "copy", "from": "/a", "path": "/c"}, {"op": "add", "path": "/c/d", "value": 2}]`, `{"a":{"b":1},"c":{"b":1,"d":2}}`},
+		{`{"a/b": 1, "m~n": 2}`, `[{"op": "test", "path": "/a~1b", "value": 1.0}, {"op": "remove", "path": "/m~0n"}]`, `{"a/b":1}`},
+	}
+
+	for i, c := range cases {
+		tmpFile, err := ioutil.TempFile("", "")
+		if err != nil {
+			t.Errorf("should not raise error: %v", err)
+		}
+
+		db, err := Open(tmpFile.Name(), 0600, nil)
+		if err != nil {
+			t.Errorf("should not raise error: %v", err)
+		}
+
+		bucket := db.Bucket("test")
+		bucket.PutRaw([]byte("key"), []byte(c.doc))
+		if err := bucket.Patch([]byte("key"), []byte(c.patch)); err != nil {
+			t.Errorf("case %d should not raise error: %v", i, err)
+		}
+
+		if v, _ := bucket.GetRaw([]byte("key")); string(v) != c.expected {
+			t.Errorf("unmatch case %d: %s (expected %s)", i, v, c.expected)
+		}
+
+		db.Close()
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}
+}
+
+func TestBucketPatch(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	bucket := db.Bucket("zoo")
+	bucket.PutRaw([]byte("key1"), []byte(`{"name": "joe", "class": "lion", "age": 5}`))
+
+	if err := bucket.Patch([]byte("key1"), []byte(`{"class": "tiger", "age": null}`)); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	assertIndexProperties(t, bucket, []string{"class", "name"})
+
+	q := bucket.Query()
+	q.Filter = &PropValueMatchFilter{Property: "class", Match: "tiger"}
+	if count, _ := q.Count(); count != 1 {
+		t.Errorf("should be 1: %d", count)
+	}
+
+	q = bucket.Query()
+	q.Filter = &PropValueMatchFilter{Property: "class", Match: "lion"}
+	if count, _ := q.Count(); count != 0 {
+		t.Errorf("should be 0: %d", count)
+	}
+
+	// a failed operation doesn't change anything.
+	err = bucket.Patch([]byte("key1"), []byte(`[{"op": "replace", "path": "/name", "value": "foo"}, {"op": "test", "path": "/class", "value": "lion"}]`))
+	if err == nil {
+		t.Errorf("should raise error")
+	}
+	if v, _ := bucket.GetRaw([]byte("key1")); string(v) != `{"class":"tiger","name":"joe"}` {
+		t.Errorf("unmatch: %s", v)
+	}
+
+	invalidPatches := []string{
+		`1`,
+		`[{"op": "unknown", "path": "/name"}]`,
+		`[{"op": "remove", "path": "/age"}]`,
+		`[{"op": "add", "path": "name", "value": 1}]`,
+		`[{"op": "move", "from": "/name", "path": "/name/first"}]`,
+		// the item must be a json object.
+		`[{"op": "replace", "path": "", "value": [1]}]`,
+	}
+	for _, p := range invalidPatches {
+		if err := bucket.Patch([]byte("key1"), []byte(p)); err == nil {
+			t.Errorf("should raise error: %s", p)
+		}
+	}
+
+	if err := bucket.Patch([]byte("key2"), []byte(`{"name": "foo"}`)); err == nil {
+		t.Errorf("should raise error")
+	}
+
+	// the patched item is validated by the schema.
+	bucket.SetSchema([]byte(`{"properties": {"class": {"enum": ["lion", "tiger"]}}}`))
+	if err := bucket.Patch([]byte("key1"), []byte(`{"class": "horse"}`)); err == nil {
+		t.Errorf("should raise error")
+	}
+
+	// in a transaction
+	err = db.Update(func(tx *Tx) error {
+		b, err := tx.Bucket("zoo")
+		if err != nil {
+			return err
+		}
+
+		return b.Patch([]byte("key1"), []byte(`[{"op": "add", "path": "/age", "value": 6}]`))
+	})
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if v, _ := bucket.GetRaw([]byte("key1")); string(v) != `{"age":6,"class":"tiger","name":"joe"}` {
+		t.Errorf("unmatch: %s", v)
+	}
+}
@@ -1,10 +1,29 @@
 package bucketstore
 
+import (
+	"bytes"
+	"encoding/json"
+)
+
 type Query struct {
 	bucket *Bucket
 	Offset uint64
 	Limit  uint64
 	Filter Filter
+	// SortBy sorts the results by the properties independent of the filter.
+	// If it is empty, the results are ordered by the filter.
+	// Unless it is a single indexed property that the filter can walk in the index order,
+	// all items matching the filter are read and sorted in memory. With Limit, only Offset+Limit items are kept in memory.
+	SortBy []SortKey
+	// After is a pagination token to resume from the position of the last item in the previous query.
+	// The token can be got by Token method after running the query.
+	After string
+	// keysOnly makes filters not to get values of items from the index.
+	keysOnly bool
+	// after is the decoded After token.
+	after *position
+	// lastPosition is the position of the last item found by the query.
+	lastPosition []byte
 }
 
 func newQuery(bucket *Bucket) *Query {
@@ -19,27 +38,36 @@ func (q *Query) AsList() (items []*Item, err error) {
 }
 
 func (q *Query) AsSingle() (item *Item, err error) {
-	items, err := q.getList()
-	if err != nil {
-		return nil, err
+	err = q.ForEach(func(i *Item) error {
+		item = i
+		return errStopIteration
+	})
+	if err == errStopIteration {
+		err = nil
 	}
 
-	if items == nil {
-		return nil, nil
+	return item, err
+}
+
+// ForEach executes a function for each item matching the query.
+// The items are read from the cursor one by one, so it doesn't load all items into memory.
+// If the function returns an error, the iteration is stopped and the error is returned.
+// The item is only valid while the function is running.
+func (q *Query) ForEach(fn func(*Item) error) error {
+	after, err := decodeToken(q.After)
+	if err != nil {
+		return err
 	}
+	q.after = after
+	q.lastPosition = nil
 
-	return items[0], nil
-}
+	fn = q.recordPosition(fn)
 
-func (q *Query) getList() (items []*Item, err error) {
 	if q.bucket.baseBucket != nil {
-		basebucket := q.bucket.baseBucket
-
-		items = q.Filter.getItems(q, basebucket)
-		return items, nil
+		return q.forEach(q.bucket.baseBucket, fn)
 	}
 
-	err = q.bucket.datastore.View(func(tx *Tx) error {
+	return q.bucket.datastore.View(func(tx *Tx) error {
 		basebucket, err := tx.baseBucket([]byte(q.bucket.name))
 		if err != nil {
 			return err
@@ -49,10 +77,115 @@ func (q *Query) getList() (items []*Item, err error) {
 			return nil
 		}
 
-		items = q.Filter.getItems(q, basebucket)
+		return q.forEach(basebucket, fn)
+	})
+}
+
+// Count counts items matching the query.
+// It walks only the keys of the cursor or the index, without getting values.
+// Offset and Limit are respected like AsList.
+func (q *Query) Count() (uint64, error) {
+	cq := *q
+	cq.keysOnly = true
+	// the order doesn't change the count.
+	cq.SortBy = nil
+
+	var count uint64
+	err := cq.ForEach(func(item *Item) error {
+		count++
+		return nil
+	})
+
+	return count, err
+}
+
+// Token returns a pagination token of the last item found by the query.
+// Set it to After of the next query to get the next page.
+// It returns an empty string if the query has not found any items.
+func (q *Query) Token() string {
+	if q.lastPosition == nil {
+		return ""
+	}
+
+	return encodeToken(q.lastPosition)
+}
+
+// recordPosition wraps the function to record the position of the last item.
+func (q *Query) recordPosition(fn func(*Item) error) func(*Item) error {
+	return func(item *Item) error {
+		if item.position != nil {
+			q.lastPosition = item.position
+		} else {
+			q.lastPosition = keyPosition(item.Key)
+		}
+
+		return fn(item)
+	}
+}
+
+// Decode unmarshals the values of items matching the query into the slice pointed to by out by encoding/json.
+//
+//	var animals []Animal
+//	err := bucket.Query().Decode(&animals)
+func (q *Query) Decode(out interface{}) error {
+	// build a json array of the values and unmarshal it at once.
+	buf := &bytes.Buffer{}
+	buf.WriteByte('[')
+
+	first := true
+	err := q.ForEach(func(item *Item) error {
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+
+		buf.Write(item.Value)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	buf.WriteByte(']')
+
+	return json.Unmarshal(buf.Bytes(), out)
+}
+
+// Iter returns an iterator to walk items matching the query.
+// The iterator holds a read-only transaction until it is closed,
+// so you must call Close after using it.
+// If the bucket is in a transaction, the iterator reads the items in the transaction instead.
+func (q *Query) Iter() *Iterator {
+	return newIterator(q)
+}
 
+func (q *Query) getList() (items []*Item, err error) {
+	err = q.ForEach(func(item *Item) error {
+		items = append(items, item)
 		return nil
 	})
 
 	return items, err
 }
+
+func (q *Query) forEach(bucket *BaseBucket, fn func(*Item) error) error {
+	if readsIndex(q.Filter) {
+		if err := bucket.checkIndexReadable(); err != nil {
+			return err
+		}
+	}
+
+	if bucket.hasExpiries() {
+		return q.skipExpiredForEach(bucket, fn)
+	}
+
+	return q.forEachItem(bucket, fn)
+}
+
+func (q *Query) forEachItem(bucket *BaseBucket, fn func(*Item) error) error {
+	if len(q.SortBy) > 0 {
+		return q.sortedForEach(bucket, fn)
+	}
+
+	return q.Filter.forEach(q, bucket, fn)
+}
@@ -1,9 +1,12 @@
 package bucketstore
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestQueryAsSingle(t *testing.T) {
@@ -142,3 +145,330 @@ func TestQueryAsListOffsetLimit(t *testing.T) {
 		t.Errorf("unmatch: %s", string(items[0].Key))
 	}
 }
+
+func TestQuerySortBy(t *testing.T) {
+	// setup database
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	ds, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer ds.Close()
+
+	bucket := ds.Bucket("zoo")
+	bucket.PutRaw([]byte("key1"), []byte(`{"name": "joe", "class": "lion", "age": 5}`))
+	bucket.PutRaw([]byte("key2"), []byte(`{"name": "foo", "class": "lion", "age": 13}`))
+	bucket.PutRaw([]byte("key3"), []byte(`{"name": "coo", "class": "tiger", "age": 6}`))
+	bucket.PutRaw([]byte("key4"), []byte(`{"name": "tony", "class": "horse"}`))
+	bucket.PutRaw([]byte("key5"), []byte(`{"name": "bar", "class": "lion", "age": 5}`))
+
+	assertKeys := func(items []*Item, expected ...string) {
+		if len(items) != len(expected) {
+			t.Errorf("invalid count: %d", len(items))
+			return
+		}
+		for i, item := range items {
+			if string(item.Key) != expected[i] {
+				t.Errorf("unmatch: %s (expected %s)", string(item.Key), expected[i])
+			}
+		}
+	}
+
+	// sort by the index
+	q := bucket.Query()
+	q.SortBy = []SortKey{{Property: "age", OrderBy: OrderByDesc}}
+	items, _ := q.AsList()
+	assertKeys(items, "key2", "key3", "key5", "key1", "key4")
+
+	q = bucket.Query()
+	q.SortBy = []SortKey{{Property: "age"}}
+	q.Offset = 2
+	q.Limit = 2
+	items, _ = q.AsList()
+	assertKeys(items, "key3", "key2")
+
+	// sort by multiple properties
+	q = bucket.Query()
+	q.Filter = &PropValueMatchFilter{Property: "class", Match: "lion"}
+	q.SortBy = []SortKey{{Property: "age", OrderBy: OrderByDesc}, {Property: "name"}}
+	items, _ = q.AsList()
+	assertKeys(items, "key2", "key5", "key1")
+
+	// sort by the property of the filter
+	q = bucket.Query()
+	q.Filter = &PropValueRangeFilter{Property: "age", Min: 5, Max: 10}
+	q.SortBy = []SortKey{{Property: "age", OrderBy: OrderByDesc}}
+	items, _ = q.AsList()
+	assertKeys(items, "key3", "key5", "key1")
+
+	// sort in memory with limit
+	q = bucket.Query()
+	q.Filter = &PropValueMatchFilter{Property: "class", Match: "lion"}
+	q.SortBy = []SortKey{{Property: "name"}}
+	q.Limit = 2
+	items, _ = q.AsList()
+	assertKeys(items, "key5", "key2")
+
+	// sort in memory with offset and limit keeps only the first offset+limit items.
+	q = bucket.Query()
+	q.SortBy = []SortKey{{Property: "class", OrderBy: OrderByDesc}, {Property: "age"}}
+	q.Offset = 1
+	q.Limit = 3
+	items, _ = q.AsList()
+	assertKeys(items, "key1", "key5", "key2")
+}
+
+func TestQueryForEachAndIter(t *testing.T) {
+	// setup database
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	ds, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer ds.Close()
+
+	bucket := ds.Bucket("test_bucket")
+	bucket.PutRaw([]byte("key1"), []byte(`{"aaa": "aaabbb", "bbb": 11}`))
+	bucket.PutRaw([]byte("key2"), []byte(`{"aaa": "aaabbbccc", "bbb": 122}`))
+	bucket.PutRaw([]byte("key3"), []byte(`{"aaa": "aaabbbddd", "bbb": 44}`))
+	bucket.PutRaw([]byte("key4"), []byte(`{"aaa": "aaabbbeee", "bbb": 12}`))
+
+	// for each with early termination
+	stopErr := errors.New("stop")
+	keys := []string{}
+	q := bucket.Query()
+	q.Filter = &PropValueRangeFilter{Property: "bbb", Min: 10, Max: 100}
+	err = q.ForEach(func(item *Item) error {
+		keys = append(keys, string(item.Key))
+		if len(keys) == 2 {
+			return stopErr
+		}
+		return nil
+	})
+	if err != stopErr {
+		t.Errorf("should return the error: %v", err)
+	}
+	if len(keys) != 2 || keys[0] != "key1" || keys[1] != "key4" {
+		t.Errorf("unmatch: %v", keys)
+	}
+
+	// iterate all
+	it := bucket.Query().Iter()
+	keys = []string{}
+	for it.Next() {
+		keys = append(keys, string(it.Item().Key))
+	}
+	if err := it.Err(); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if err := it.Close(); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if len(keys) != 4 {
+		t.Errorf("unmatch: %v", keys)
+	}
+
+	// close before the end
+	it = bucket.Query().Iter()
+	if !it.Next() || string(it.Item().Key) != "key1" {
+		t.Errorf("unmatch: %v", it.Item())
+	}
+	if err := it.Close(); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if it.Next() {
+		t.Errorf("closed iterator should not have next item")
+	}
+
+	// the database can be updated after closing the iterator.
+	if err := bucket.PutRaw([]byte("key5"), []byte(`{"aaa": "x"}`)); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+}
+
+func TestQueryIterAbandoned(t *testing.T) {
+	// setup database
+	tmpFile, err := ioutil.TempFile("", "")
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	ds, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	bucket := ds.Bucket("test_bucket")
+	bucket.PutRaw([]byte("key1"), []byte(`{"aaa": "x"}`))
+	bucket.PutRaw([]byte("key2"), []byte(`{"aaa": "y"}`))
+
+	// the iterator is abandoned without closing.
+	it := bucket.Query().Iter()
+	if !it.Next() || string(it.Item().Key) != "key1" {
+		t.Errorf("unmatch: %v", it.Item())
+	}
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- ds.Close()
+	}()
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("should not raise error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("closing the database should not be blocked by the abandoned iterator")
+	}
+
+	if it.Next() {
+		t.Errorf("stopped iterator should not have next item")
+	}
+	if err := it.Err(); err != ErrDatabaseClosed {
+		t.Errorf("should be ErrDatabaseClosed: %v", err)
+	}
+}
+
+func TestQueryIterInTx(t *testing.T) {
+	// setup database
+	tmpFile, err := ioutil.TempFile("", "")
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	ds, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer ds.Close()
+
+	err = ds.Update(func(tx *Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists("test_bucket")
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < 250; i++ {
+			if err := bucket.PutRaw([]byte(fmt.Sprintf("key%03d", i)), []byte(`{"aaa": "x"}`)); err != nil {
+				return err
+			}
+		}
+
+		// the items are read over the pages in the transaction.
+		q := bucket.Query()
+		q.Offset = 10
+		q.Limit = 200
+		it := q.Iter()
+		keys := []string{}
+		for it.Next() {
+			keys = append(keys, string(it.Item().Key))
+
+			// the transaction can be modified while iterating.
+			if err := bucket.PutRaw(it.Item().Key, []byte(`{"aaa": "y"}`)); err != nil {
+				return err
+			}
+		}
+		if err := it.Close(); err != nil {
+			return err
+		}
+		if len(keys) != 200 || keys[0] != "key010" || keys[199] != "key209" {
+			t.Errorf("unmatch: %d %v", len(keys), keys)
+		}
+
+		// close before the end
+		it = bucket.Query().Iter()
+		if !it.Next() || string(it.Item().Key) != "key000" {
+			t.Errorf("unmatch: %v", it.Item())
+		}
+		if err := it.Close(); err != nil {
+			return err
+		}
+		if it.Next() {
+			t.Errorf("closed iterator should not have next item")
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+}
+
+func TestQueryCount(t *testing.T) {
+	// setup database
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	ds, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer ds.Close()
+
+	bucket := ds.Bucket("test_bucket")
+	bucket.PutRaw([]byte("key1"), []byte(`{"aaa": "aaabbb", "bbb": 11}`))
+	bucket.PutRaw([]byte("key2"), []byte(`{"aaa": "aaabbbccc", "bbb": 122}`))
+	bucket.PutRaw([]byte("key3"), []byte(`{"aaa": "aaabbbddd", "bbb": 44}`))
+	bucket.PutRaw([]byte("key4"), []byte(`{"aaa": "aaabbbeee", "bbb": 12}`))
+	bucket.PutRaw([]byte("key5"), []byte(`{"aaa": "aaabbbccc", "bbb": 1}`))
+
+	q := bucket.Query()
+	if count, _ := q.Count(); count != 5 {
+		t.Errorf("invalid count: %d", count)
+	}
+
+	q = bucket.Query()
+	q.Filter = &PropValueRangeFilter{Property: "bbb", Min: 10, Max: 100}
+	if count, _ := q.Count(); count != 3 {
+		t.Errorf("invalid count: %d", count)
+	}
+
+	q.Offset = 1
+	if count, _ := q.Count(); count != 2 {
+		t.Errorf("invalid count: %d", count)
+	}
+
+	q.Limit = 1
+	if count, _ := q.Count(); count != 1 {
+		t.Errorf("invalid count: %d", count)
+	}
+
+	q = bucket.Query()
+	q.Filter = &AndFilter{Filters: []Filter{
+		&PropValuePrefixFilter{Property: "aaa", Prefix: "aaabbbc"},
+		&PropValueRangeFilter{Property: "bbb", Min: 0, Max: 100},
+	}}
+	if count, _ := q.Count(); count != 1 {
+		t.Errorf("invalid count: %d", count)
+	}
+
+	// not existing bucket
+	if count, _ := ds.Bucket("unknown").Query().Count(); count != 0 {
+		t.Errorf("invalid count: %d", count)
+	}
+}
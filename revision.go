@@ -0,0 +1,122 @@
+package bucketstore
+
+import (
+	"fmt"
+	"github.com/kohkimakimoto/bucketstore/v/bolt"
+)
+
+//
+// # Revision specification.
+//
+// A revision of an item is stored in the revisions bucket of the system area per bucket,
+// so that it doesn't change the value of the item.
+//
+//   <key> : <revision:8 bytes>
+//
+// The revision starts from 1 and is incremented every time the item is put.
+// The revision of an item that doesn't exist is 0.
+//
+
+// ErrConflict is returned when a conditional write finds the revision of the item is not the expected one.
+type ErrConflict struct {
+	// Key is the key of the item.
+	Key []byte
+	// Expected is the expected revision. 0 means the item must not exist.
+	Expected uint64
+	// Actual is the current revision. 0 means the item doesn't exist.
+	Actual uint64
+}
+
+func (e *ErrConflict) Error() string {
+	if e.Expected == 0 {
+		return fmt.Sprintf("conflict: the item %q already exists at the revision %d", string(e.Key), e.Actual)
+	}
+
+	return fmt.Sprintf("conflict: the revision of the item %q is %d, but %d is expected", string(e.Key), e.Actual, e.Expected)
+}
+
+// Revision gets the revision of the item. It returns 0 if the item doesn't exist or has been expired.
+func (b *BaseBucket) Revision(key []byte) uint64 {
+	bucket := b.revisionBucket()
+	if bucket == nil || b.isExpired(key, timeNow()) {
+		return 0
+	}
+
+	v := bucket.Get(key)
+	if v == nil {
+		return 0
+	}
+
+	return BytesToUint64(v)
+}
+
+// PutIf puts the item only if the revision of the item is the expected revision.
+// It returns ErrConflict if the revision doesn't match.
+func (b *BaseBucket) PutIf(key []byte, value []byte, expectedRevision uint64) error {
+	if actual := b.Revision(key); actual != expectedRevision {
+		return &ErrConflict{Key: key, Expected: expectedRevision, Actual: actual}
+	}
+
+	return b.Put(key, value)
+}
+
+// PutIfAbsent puts the item only if the item doesn't exist.
+// It returns ErrConflict if the item exists.
+func (b *BaseBucket) PutIfAbsent(key []byte, value []byte) error {
+	return b.PutIf(key, value, 0)
+}
+
+// DeleteIf deletes the item only if the revision of the item is the expected revision.
+// It returns ErrConflict if the revision doesn't match.
+func (b *BaseBucket) DeleteIf(key []byte, expectedRevision uint64) error {
+	if actual := b.Revision(key); actual != expectedRevision {
+		return &ErrConflict{Key: key, Expected: expectedRevision, Actual: actual}
+	}
+
+	return b.Delete(key)
+}
+
+// getItem gets the item with its revision. It returns nil if the item doesn't exist.
+func (b *BaseBucket) getItem(key []byte) *Item {
+	v := b.Get(key)
+	if v == nil {
+		return nil
+	}
+
+	return &Item{Key: key, Value: v, Revision: b.Revision(key)}
+}
+
+func (b *BaseBucket) revisionBucket() *bolt.Bucket {
+	// the database opened in the read only mode may not have the revisions bucket.
+	revisions := b.tx.bRevisions()
+	if revisions == nil {
+		return nil
+	}
+
+	return revisions.Bucket(b.name)
+}
+
+// incrementRevision increments the revision of the item after putting it.
+func (b *BaseBucket) incrementRevision(key []byte) error {
+	bucket, err := b.tx.bRevisions().CreateBucketIfNotExists(b.name)
+	if err != nil {
+		return err
+	}
+
+	var revision uint64 = 1
+	if v := bucket.Get(key); v != nil {
+		revision = BytesToUint64(v) + 1
+	}
+
+	return bucket.Put(key, Uint64ToBytes(revision))
+}
+
+// deleteRevision deletes the revision of the item after deleting it.
+func (b *BaseBucket) deleteRevision(key []byte) error {
+	bucket := b.revisionBucket()
+	if bucket == nil {
+		return nil
+	}
+
+	return bucket.Delete(key)
+}
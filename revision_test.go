@@ -0,0 +1,112 @@
+package bucketstore
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestBucketRevision(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	bucket := db.Bucket("zoo")
+
+	if err := bucket.PutIfAbsent([]byte("key1"), []byte(`{"name": "joe"}`)); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	item, err := bucket.Get([]byte("key1"))
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if item.Revision != 1 {
+		t.Errorf("should be 1: %d", item.Revision)
+	}
+
+	// the value isn't changed by the revision.
+	if string(item.Value) != `{"name":"joe"}` {
+		t.Errorf("unmatch: %s", item.Value)
+	}
+
+	err = bucket.PutIfAbsent([]byte("key1"), []byte(`{"name": "foo"}`))
+	if e, ok := err.(*ErrConflict); !ok || e.Expected != 0 || e.Actual != 1 {
+		t.Errorf("should raise ErrConflict: %v", err)
+	}
+
+	if err := bucket.PutIf([]byte("key1"), []byte(`{"name": "foo"}`), 1); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	// the second writer that read the revision 1 loses.
+	err = bucket.PutIf([]byte("key1"), []byte(`{"name": "coo"}`), 1)
+	if e, ok := err.(*ErrConflict); !ok || string(e.Key) != "key1" || e.Expected != 1 || e.Actual != 2 {
+		t.Errorf("should raise ErrConflict: %v", err)
+	}
+	if v, _ := bucket.GetRaw([]byte("key1")); string(v) != `{"name":"foo"}` {
+		t.Errorf("unmatch: %s", v)
+	}
+
+	// a unconditional put increments the revision too.
+	bucket.PutRaw([]byte("key1"), []byte(`{"name": "coo"}`))
+	if item, _ := bucket.Get([]byte("key1")); item.Revision != 3 {
+		t.Errorf("should be 3: %d", item.Revision)
+	}
+
+	err = bucket.DeleteIf([]byte("key1"), 2)
+	if _, ok := err.(*ErrConflict); !ok {
+		t.Errorf("should raise ErrConflict: %v", err)
+	}
+
+	if err := bucket.DeleteIf([]byte("key1"), 3); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if item, _ := bucket.Get([]byte("key1")); item != nil {
+		t.Errorf("should be nil: %v", item)
+	}
+
+	// the revision starts again after deleting.
+	if err := bucket.PutIf([]byte("key1"), []byte(`{"name": "joe"}`), 0); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if item, _ := bucket.Get([]byte("key1")); item.Revision != 1 {
+		t.Errorf("should be 1: %d", item.Revision)
+	}
+
+	if err := db.Bucket("unknown").DeleteIf([]byte("key1"), 1); err == nil {
+		t.Errorf("should raise error")
+	}
+
+	// in a transaction
+	err = db.Update(func(tx *Tx) error {
+		b, err := tx.Bucket("zoo")
+		if err != nil {
+			return err
+		}
+
+		item, err := b.Get([]byte("key1"))
+		if err != nil {
+			return err
+		}
+
+		return b.PutIf([]byte("key1"), []byte(`{"name": "foo"}`), item.Revision)
+	})
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if item, _ := bucket.Get([]byte("key1")); item.Revision != 2 {
+		t.Errorf("should be 2: %d", item.Revision)
+	}
+}
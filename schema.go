@@ -0,0 +1,340 @@
+package bucketstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Schema is a JSON Schema to validate items of a bucket.
+// It supports a subset of the draft-7 keywords:
+// type, required, properties, enum, minimum, maximum, pattern and additionalProperties.
+type Schema struct {
+	// Type is a type name or a list of type names.
+	Type       interface{}        `json:"type,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Enum       []interface{}      `json:"enum,omitempty"`
+	Minimum    *float64           `json:"minimum,omitempty"`
+	Maximum    *float64           `json:"maximum,omitempty"`
+	Pattern    string             `json:"pattern,omitempty"`
+	// AdditionalProperties is a boolean or a schema of the properties not listed in Properties.
+	AdditionalProperties json.RawMessage `json:"additionalProperties,omitempty"`
+
+	types                []string
+	pattern              *regexp.Regexp
+	additionalAllowed    bool
+	additionalProperties *Schema
+}
+
+// ParseSchema parses the JSON Schema.
+func ParseSchema(b []byte) (*Schema, error) {
+	schema := &Schema{}
+	if err := json.Unmarshal(b, schema); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+
+	if err := schema.compile(""); err != nil {
+		return nil, err
+	}
+
+	return schema, nil
+}
+
+func (s *Schema) compile(path string) error {
+	switch t := s.Type.(type) {
+	case nil:
+	case string:
+		s.types = []string{t}
+	case []interface{}:
+		for _, v := range t {
+			name, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("invalid schema: %s: type must be a string or an array of strings", schemaPathString(path))
+			}
+			s.types = append(s.types, name)
+		}
+	default:
+		return fmt.Errorf("invalid schema: %s: type must be a string or an array of strings", schemaPathString(path))
+	}
+
+	for _, t := range s.types {
+		switch t {
+		case "object", "array", "string", "number", "integer", "boolean", "null":
+		default:
+			return fmt.Errorf("invalid schema: %s: unsupported type %s", schemaPathString(path), t)
+		}
+	}
+
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid schema: %s: %v", schemaPathString(path), err)
+		}
+		s.pattern = re
+	}
+
+	s.additionalAllowed = true
+	if len(s.AdditionalProperties) > 0 {
+		var allowed bool
+		if err := json.Unmarshal(s.AdditionalProperties, &allowed); err == nil {
+			s.additionalAllowed = allowed
+		} else {
+			additional := &Schema{}
+			if err := json.Unmarshal(s.AdditionalProperties, additional); err != nil {
+				return fmt.Errorf("invalid schema: %s: additionalProperties must be a boolean or a schema", schemaPathString(path))
+			}
+			if err := additional.compile(path); err != nil {
+				return err
+			}
+			s.additionalProperties = additional
+		}
+	}
+
+	for n, p := range s.Properties {
+		if err := p.compile(joinSchemaPath(path, n)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SchemaViolation is a violation of the schema at the dotted property path.
+type SchemaViolation struct {
+	// Path is the dotted property path like 'address.city'. It is empty for the item itself.
+	Path    string
+	Message string
+}
+
+func (v *SchemaViolation) String() string {
+	return schemaPathString(v.Path) + ": " + v.Message
+}
+
+// ErrSchemaViolation is returned when putting an item that doesn't conform to the schema of the bucket.
+type ErrSchemaViolation struct {
+	// Key is the key of the item.
+	Key        []byte
+	Violations []*SchemaViolation
+}
+
+func (e *ErrSchemaViolation) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.String())
+	}
+
+	return fmt.Sprintf("schema violation of the item %q: %s", string(e.Key), strings.Join(messages, "; "))
+}
+
+// Validate validates the value decoded from JSON and returns the violations.
+func (s *Schema) Validate(value interface{}) []*SchemaViolation {
+	violations := []*SchemaViolation{}
+	s.validate("", value, &violations)
+	return violations
+}
+
+func (s *Schema) validate(path string, value interface{}, violations *[]*SchemaViolation) {
+	addViolation := func(format string, args ...interface{}) {
+		*violations = append(*violations, &SchemaViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// the items are decoded with json.Number to keep the precision for the index.
+	if n, ok := value.(json.Number); ok {
+		f, err := n.Float64()
+		if err != nil {
+			addViolation("must be a number")
+			return
+		}
+		value = f
+	}
+
+	if len(s.types) > 0 && !matchSchemaTypes(s.types, value) {
+		addViolation("must be %s", strings.Join(s.types, " or "))
+		// the other keywords are meaningless for the different type.
+		return
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			// the nested numbers of the value are json.Number while the enum values have float64.
+			if jsonValueEqual(e, value) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			addViolation("must be one of the enum values")
+		}
+	}
+
+	switch v := value.(type) {
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			addViolation("must be >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			addViolation("must be <= %v", *s.Maximum)
+		}
+	case string:
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			addViolation("must match the pattern %s", s.Pattern)
+		}
+	case map[string]interface{}:
+		for _, n := range s.Required {
+			if _, ok := v[n]; !ok {
+				*violations = append(*violations, &SchemaViolation{Path: joinSchemaPath(path, n), Message: "is required"})
+			}
+		}
+
+		// validates the properties in the order of the names to get stable results.
+		names := make([]string, 0, len(v))
+		for n := range v {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+		for _, n := range names {
+			if p, ok := s.Properties[n]; ok {
+				p.validate(joinSchemaPath(path, n), v[n], violations)
+			} else if s.additionalProperties != nil {
+				s.additionalProperties.validate(joinSchemaPath(path, n), v[n], violations)
+			} else if !s.additionalAllowed {
+				*violations = append(*violations, &SchemaViolation{Path: joinSchemaPath(path, n), Message: "is not allowed"})
+			}
+		}
+	}
+}
+
+func matchSchemaTypes(types []string, value interface{}) bool {
+	for _, t := range types {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case float64:
+			if t == "number" || (t == "integer" && v == math.Trunc(v)) {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case nil:
+			if t == "null" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func joinSchemaPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+func schemaPathString(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+
+	return path
+}
+
+// Schema gets the JSON Schema of the bucket. It returns nil if the bucket doesn't have a schema.
+func (b *BaseBucket) Schema() []byte {
+	// the database opened in the read only mode may not have the schemas bucket.
+	bucket := b.tx.bSchemas()
+	if bucket == nil {
+		return nil
+	}
+
+	return bucket.Get(b.name)
+}
+
+// SetSchema sets the JSON Schema of the bucket.
+// It returns ErrSchemaViolation if the existing items don't conform to the schema.
+func (b *BaseBucket) SetSchema(schemaBytes []byte) error {
+	schema, err := ParseSchema(schemaBytes)
+	if err != nil {
+		return err
+	}
+
+	if b.ValueMode() == ValueModeRaw {
+		return fmt.Errorf("the bucket in the raw mode can't have a schema")
+	}
+
+	err = b.data.ForEach(func(key, value []byte) error {
+		var v interface{}
+		if err := decodeJSON(value, &v); err != nil {
+			return nil
+		}
+
+		if violations := schema.Validate(v); len(violations) > 0 {
+			return &ErrSchemaViolation{Key: append([]byte{}, key...), Violations: violations}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := b.tx.bSchemas().Put(b.name, schemaBytes); err != nil {
+		return err
+	}
+
+	b.schema = schema
+	return nil
+}
+
+// DropSchema removes the JSON Schema of the bucket.
+func (b *BaseBucket) DropSchema() error {
+	if err := b.tx.bSchemas().Delete(b.name); err != nil {
+		return err
+	}
+
+	b.schema = nil
+	return nil
+}
+
+// validateSchema validates the item by the schema of the bucket.
+func (b *BaseBucket) validateSchema(key []byte, value interface{}) error {
+	if b.schema == nil {
+		schemaBytes := b.Schema()
+		if schemaBytes == nil {
+			return nil
+		}
+
+		schema, err := ParseSchema(schemaBytes)
+		if err != nil {
+			return err
+		}
+		b.schema = schema
+	}
+
+	if violations := b.schema.Validate(value); len(violations) > 0 {
+		return &ErrSchemaViolation{Key: key, Violations: violations}
+	}
+
+	return nil
+}
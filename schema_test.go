@@ -0,0 +1,173 @@
+package bucketstore
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := ParseSchema([]byte(`{
+		"type": "object",
+		"required": ["name", "class"],
+		"properties": {
+			"name": {"type": "string", "pattern": "^[a-z]+$"},
+			"class": {"enum": ["lion", "tiger"]},
+			"age": {"type": "integer", "minimum": 0, "maximum": 30},
+			"weight": {"type": ["number", "null"]},
+			"address": {
+				"type": "object",
+				"properties": {"city": {"type": "string"}},
+				"additionalProperties": false
+			},
+			"tags": {"type": "array"},
+			"size": {"enum": [{"width": 1, "height": 2}, [1, 2.5], 3]}
+		},
+		"additionalProperties": {"type": "boolean"}
+	}`))
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+
+	cases := []struct {
+		value    map[string]interface{}
+		expected []string
+	}{
+		{
+			map[string]interface{}{"name": "joe", "class": "lion", "age": 5.0, "weight": nil, "address": map[string]interface{}{"city": "Tokyo"}, "tags": []interface{}{}, "male": true},
+			[]string{},
+		},
+		{
+			map[string]interface{}{"name": "Joe", "age": 5.5, "weight": "heavy"},
+			[]string{"class: is required", "age: must be integer", "name: must match the pattern ^[a-z]+$", "weight: must be number or null"},
+		},
+		{
+			map[string]interface{}{"name": "joe", "class": "horse", "age": 31.0, "address": map[string]interface{}{"zip": "100"}, "male": "yes"},
+			[]string{"address.zip: is not allowed", "age: must be <= 30", "class: must be one of the enum values", "male: must be boolean"},
+		},
+		// the items are decoded with json.Number.
+		{
+			map[string]interface{}{"name": "joe", "class": "lion", "size": map[string]interface{}{"width": json.Number("1"), "height": json.Number("2.0")}},
+			[]string{},
+		},
+		{
+			map[string]interface{}{"name": "joe", "class": "lion", "size": []interface{}{json.Number("1"), json.Number("2.5")}},
+			[]string{},
+		},
+		{
+			map[string]interface{}{"name": "joe", "class": "lion", "size": json.Number("3")},
+			[]string{},
+		},
+		{
+			map[string]interface{}{"name": "joe", "class": "lion", "size": []interface{}{json.Number("1"), json.Number("2")}},
+			[]string{"size: must be one of the enum values"},
+		},
+	}
+
+	for i, c := range cases {
+		messages := []string{}
+		for _, v := range schema.Validate(c.value) {
+			messages = append(messages, v.String())
+		}
+
+		if !reflect.DeepEqual(messages, c.expected) {
+			t.Errorf("unmatch case %d: %v (expected %v)", i, messages, c.expected)
+		}
+	}
+
+	invalidSchemas := []string{
+		`{"type": "unknown"}`,
+		`{"type": 1}`,
+		`{"pattern": "("}`,
+		`{"additionalProperties": 1}`,
+		`{"properties": {"name": {"type": "foo"}}}`,
+		`[]`,
+	}
+	for _, s := range invalidSchemas {
+		if _, err := ParseSchema([]byte(s)); err == nil {
+			t.Errorf("should raise error: %s", s)
+		}
+	}
+}
+
+func TestBucketSchema(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	bucket := db.Bucket("zoo")
+	bucket.PutRaw([]byte("key1"), []byte(`{"name": 1}`))
+
+	schema := []byte(`{"required": ["name"], "properties": {"name": {"type": "string"}}}`)
+
+	// the existing items don't conform to the schema.
+	err = bucket.SetSchema(schema)
+	if e, ok := err.(*ErrSchemaViolation); !ok || string(e.Key) != "key1" || len(e.Violations) != 1 || e.Violations[0].Path != "name" {
+		t.Errorf("should raise ErrSchemaViolation: %v", err)
+	}
+
+	bucket.PutRaw([]byte("key1"), []byte(`{"name": "joe"}`))
+	if err := bucket.SetSchema(schema); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	s, err := bucket.Schema()
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if string(s) != string(schema) {
+		t.Errorf("unmatch: %s", s)
+	}
+
+	err = bucket.PutRaw([]byte("key2"), []byte(`{"age": 3}`))
+	if e, ok := err.(*ErrSchemaViolation); !ok || string(e.Key) != "key2" || e.Violations[0].Path != "name" {
+		t.Errorf("should raise ErrSchemaViolation: %v", err)
+	}
+	if v, _ := bucket.GetRaw([]byte("key2")); v != nil {
+		t.Errorf("should be nil: %s", v)
+	}
+
+	// in a transaction
+	err = db.Update(func(tx *Tx) error {
+		b, err := tx.Bucket("zoo")
+		if err != nil {
+			return err
+		}
+
+		if err := b.PutRaw([]byte("key2"), []byte(`{"name": false}`)); err == nil {
+			t.Errorf("should raise error")
+		}
+
+		return b.PutRaw([]byte("key2"), []byte(`{"name": "foo"}`))
+	})
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	if err := bucket.DropSchema(); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if err := bucket.PutRaw([]byte("key3"), []byte(`{"age": 3}`)); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if s, _ := bucket.Schema(); s != nil {
+		t.Errorf("should be nil: %s", s)
+	}
+
+	if err := bucket.SetSchema([]byte(`{"type": "foo"}`)); err == nil {
+		t.Errorf("should raise error")
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"github.com/kohkimakimoto/bucketstore"
 	"github.com/kohkimakimoto/bucketstore/shell"
+	"io"
 	"os"
+	"strings"
 )
 
 func main() {
@@ -33,6 +36,14 @@ func realMain() int {
 		return 0
 	}
 
+	// subcommands run without the interactive shell.
+	switch flag.Arg(0) {
+	case "export":
+		return exportMain(flag.Args()[1:])
+	case "import":
+		return importMain(flag.Args()[1:])
+	}
+
 	if len(flag.Args()) != 1 {
 		fmt.Fprintf(os.Stderr, "Error: illegal argument.\n")
 		flag.Usage()
@@ -76,11 +87,203 @@ func realMain() int {
 	return 0
 }
 
+func exportMain(args []string) int {
+	var opto, optf, optk, optc string
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.StringVar(&opto, "o", "", "")
+	fs.StringVar(&opto, "output", "", "")
+	fs.StringVar(&optf, "f", "jsonl", "")
+	fs.StringVar(&optf, "format", "jsonl", "")
+	fs.StringVar(&optk, "k", "", "")
+	fs.StringVar(&optk, "key-column", "", "")
+	fs.StringVar(&optc, "c", "", "")
+	fs.StringVar(&optc, "columns", "", "")
+	fs.Usage = printUsage
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if optf != "jsonl" && optf != "csv" {
+		fmt.Fprintf(os.Stderr, "Error: unsupported format: %s\n", optf)
+		return 1
+	}
+
+	if len(fs.Args()) != 2 {
+		fmt.Fprintf(os.Stderr, "Error: illegal argument.\n")
+		printUsage()
+		return 1
+	}
+
+	// the keys can't be restored from CSV without the key column, so it must be specified explicitly.
+	keyColumnSet := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "k" || f.Name == "key-column" {
+			keyColumnSet = true
+		}
+	})
+	if optf == "csv" && !keyColumnSet {
+		fmt.Fprintf(os.Stderr, "Error: -k|-key-column is required for CSV. specify '' not to export the keys.\n")
+		return 1
+	}
+
+	options := bucketstore.NewOptions()
+	options.ReadOnly = true
+
+	db, err := bucketstore.Open(fs.Arg(0), 0600, options)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	w := os.Stdout
+	if opto != "" {
+		f, err := os.Create(opto)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+
+	bw := bufio.NewWriter(w)
+	bucket := db.Bucket(fs.Arg(1))
+
+	var n int
+	if optf == "csv" {
+		csvOptions := &bucketstore.CSVOptions{KeyColumn: optk}
+		if optc != "" {
+			csvOptions.Columns = strings.Split(optc, ",")
+		}
+		n, err = bucket.ExportCSV(bw, csvOptions)
+	} else {
+		n, err = bucket.Export(bw)
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "exported %d items.\n", n)
+	return 0
+}
+
+func importMain(args []string) int {
+	var opts, optq, optn bool
+	var optb int
+	var optf, optk string
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.StringVar(&optf, "f", "jsonl", "")
+	fs.StringVar(&optf, "format", "jsonl", "")
+	fs.StringVar(&optk, "k", "", "")
+	fs.StringVar(&optk, "key-column", "", "")
+	fs.BoolVar(&opts, "s", false, "")
+	fs.BoolVar(&opts, "skip-existing", false, "")
+	fs.IntVar(&optb, "b", 0, "")
+	fs.IntVar(&optb, "batch-size", 0, "")
+	fs.BoolVar(&optq, "q", false, "")
+	fs.BoolVar(&optq, "quiet", false, "")
+	fs.BoolVar(&optn, "n", false, "")
+	fs.BoolVar(&optn, "no-infer", false, "")
+	fs.Usage = printUsage
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if len(fs.Args()) != 2 && len(fs.Args()) != 3 {
+		fmt.Fprintf(os.Stderr, "Error: illegal argument.\n")
+		printUsage()
+		return 1
+	}
+
+	if optf != "jsonl" && optf != "csv" {
+		fmt.Fprintf(os.Stderr, "Error: unsupported format: %s\n", optf)
+		return 1
+	}
+
+	var r io.Reader = os.Stdin
+	if len(fs.Args()) == 3 {
+		f, err := os.Open(fs.Arg(2))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		r = f
+	}
+
+	db, err := bucketstore.Open(fs.Arg(0), 0600, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	importOptions := &bucketstore.ImportOptions{
+		Mode:      bucketstore.ImportModeUpsert,
+		BatchSize: optb,
+	}
+	if opts {
+		importOptions.Mode = bucketstore.ImportModeSkipExisting
+	}
+	if !optq {
+		importOptions.Progress = func(result *bucketstore.ImportResult) {
+			fmt.Fprintf(os.Stderr, "read %d items. imported %d items. skipped %d items.\n", result.Read, result.Imported, result.Skipped)
+		}
+	}
+
+	bucket := db.Bucket(fs.Arg(1))
+
+	var result *bucketstore.ImportResult
+	if optf == "csv" {
+		result, err = bucket.ImportCSV(bufio.NewReader(r), &bucketstore.CSVOptions{KeyColumn: optk, NoTypeInference: optn}, importOptions)
+	} else {
+		result, err = bucket.Import(bufio.NewReader(r), importOptions)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if result != nil {
+			fmt.Fprintf(os.Stderr, "imported %d items before the error.\n", result.Imported)
+		}
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "imported %d items. skipped %d items.\n", result.Imported, result.Skipped)
+	return 0
+}
+
 func printUsage() {
 	fmt.Println(`Usage: bucketstore [<options>] <database_file>
+       bucketstore export [<export_options>] <database_file> <bucket>
+       bucketstore import [<import_options>] <database_file> <bucket> [<jsonl_file>]
 
 Options:
   -r|-read      Load a database file by read only mode.
   -n|-new       Create a new database.
+
+Export options:
+  -o|-output <file>           Write the items to the file instead of the stdout.
+  -f|-format jsonl|csv        Format of the items. (default jsonl)
+  -k|-key-column <column>     Column of the keys in CSV like '_key'. It is required for CSV.
+                              If it is '', the keys are not exported.
+  -c|-columns <columns>       Comma separated property paths of the columns in CSV.
+                              All properties are exported by default.
+
+Import options:
+  -f|-format jsonl|csv        Format of the items. (default jsonl)
+  -k|-key-column <column>     Column of the keys in CSV like '_key'.
+                              The keys are generated by the sequence by default.
+  -n|-no-infer                Import all cells of CSV as strings without inferring the types.
+  -s|-skip-existing           Don't overwrite the items whose keys exist.
+  -b|-batch-size <number>     Number of items put in a transaction. (default 1000)
+  -q|-quiet                   Don't report the progress.
+
+The items are exported and imported as JSON Lines of {"key": <key>, "value": <value>} by default.
+CSV has a header row of the key column and the property paths like 'address.city'.
+The import reads the stdin if the file is not specified.
 `)
 }
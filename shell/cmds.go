@@ -1,6 +1,7 @@
 package shell
 
 import (
+	"bytes"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -19,10 +20,15 @@ var Cmds = map[string]CmdFunc{
 	"help":    doHelp,
 	"buckets": doBuckets,
 	"put":     doPut,
+	"patch":   doPatch,
 	"post":    doPost,
 	"get":     doGet,
 	"delete":  doDelete,
 	"select":  doSelect,
+	"count":   doCount,
+	"schema":  doSchema,
+	"check":   doCheck,
+	"reindex": doReindex,
 }
 
 func doExit(sh *Shell, args []*Token) (*Response, error) {
@@ -81,7 +87,7 @@ func doBuckets(sh *Shell, args []*Token) (*Response, error) {
 
 		res = &Response{
 			Status: "ok",
-			Count:  uint64(len(buckets)),
+			Count:  countOf(uint64(len(buckets))),
 			Body:   buckets,
 		}
 
@@ -123,8 +129,7 @@ func doPut(sh *Shell, args []*Token) (*Response, error) {
 
 	responseItem["key"] = "0x" + hex.EncodeToString(keyName)
 
-	jsonValue := map[string]interface{}{}
-	err = json.Unmarshal(value, &jsonValue)
+	jsonValue, err := decodeJSONValue(value)
 	if err == nil {
 		responseItem["value"] = jsonValue
 	} else {
@@ -138,6 +143,45 @@ func doPut(sh *Shell, args []*Token) (*Response, error) {
 	}, nil
 }
 
+func doPatch(sh *Shell, args []*Token) (*Response, error) {
+	for _, token := range args {
+		if token.DataType == DataTypeTerm && strings.HasPrefix(token.Buf, "-") {
+			switch {
+			default:
+				return nil, fmt.Errorf("unsupported option: %s", token.Buf)
+			}
+		}
+	}
+
+	if len(args) != 3 {
+		return nil, fmt.Errorf("invalid arguments. 'patch' requires 3 arguments")
+	}
+
+	if args[0].DataType != DataTypeString {
+		return nil, fmt.Errorf("the bucket name must be string: %s", args[0].Buf)
+	}
+
+	bucketName := args[0].Buf
+	keyName := args[1].ToMustBytes()
+	patch := args[2].ToMustBytes()
+
+	bucket := sh.DB.Bucket(bucketName)
+	if err := bucket.Patch(keyName, patch); err != nil {
+		return nil, err
+	}
+
+	value, err := bucket.GetRaw(keyName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		Status: "ok",
+		Bucket: bucketName,
+		Body:   newResponseItem(keyName, value),
+	}, nil
+}
+
 func doPost(sh *Shell, args []*Token) (*Response, error) {
 	for _, token := range args {
 		if token.DataType == DataTypeTerm && strings.HasPrefix(token.Buf, "-") {
@@ -174,8 +218,7 @@ func doPost(sh *Shell, args []*Token) (*Response, error) {
 
 	responseItem["key"] = "0x" + hex.EncodeToString(keyName)
 
-	jsonValue := map[string]interface{}{}
-	err = json.Unmarshal(value, &jsonValue)
+	jsonValue, err := decodeJSONValue(value)
 	if err == nil {
 		responseItem["value"] = jsonValue
 	} else {
@@ -215,28 +258,19 @@ func doGet(sh *Shell, args []*Token) (*Response, error) {
 	keyName := args[1].ToMustBytes()
 	bucket := sh.DB.Bucket(bucketName)
 
-	value, err := bucket.GetRaw(keyName)
+	item, err := bucket.Get(keyName)
 	if err != nil {
 		return nil, err
 	}
-	if value == nil {
+	if item == nil {
 		return &Response{
 			Status: "ok",
 			Body:   nil,
 		}, nil
 	}
 
-	responseItem := map[string]interface{}{}
-
-	responseItem["key"] = "0x" + hex.EncodeToString(keyName)
-
-	jsonValue := map[string]interface{}{}
-	err = json.Unmarshal(value, &jsonValue)
-	if err == nil {
-		responseItem["value"] = jsonValue
-	} else {
-		responseItem["value"] = value
-	}
+	responseItem := newResponseItem(item.Key, item.Value)
+	responseItem["revision"] = item.Revision
 
 	return &Response{
 		Status: "ok",
@@ -295,6 +329,131 @@ func doDelete(sh *Shell, args []*Token) (*Response, error) {
 }
 
 func doSelect(sh *Shell, args []*Token) (*Response, error) {
+	q, bucketName, err := buildQuery(sh, args)
+	if err != nil {
+		return nil, err
+	}
+
+	// stream items as json lines.
+	var count uint64
+	err = q.ForEach(func(item *bucketstore.Item) error {
+		count++
+		return sh.outputLine(newResponseItem(item.Key, item.Value))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Response{
+		Status: "ok",
+		Bucket: bucketName,
+		Count:  countOf(count),
+		Token:  q.Token(),
+	}
+
+	return res, nil
+}
+
+func doCount(sh *Shell, args []*Token) (*Response, error) {
+	q, bucketName, err := buildQuery(sh, args)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := q.Count()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		Status: "ok",
+		Bucket: bucketName,
+		Count:  countOf(count),
+	}, nil
+}
+
+func doSchema(sh *Shell, args []*Token) (*Response, error) {
+	for _, token := range args {
+		if token.DataType == DataTypeTerm && strings.HasPrefix(token.Buf, "-") {
+			switch {
+			default:
+				return nil, fmt.Errorf("unsupported option: %s", token.Buf)
+			}
+		}
+	}
+
+	if len(args) < 2 {
+		return nil, fmt.Errorf("invalid arguments. 'schema' requires a subcommand and a bucket")
+	}
+
+	if args[0].DataType != DataTypeTerm {
+		return nil, fmt.Errorf("invalid arguments")
+	}
+
+	if args[1].DataType != DataTypeString {
+		return nil, fmt.Errorf("the bucket name must be string: %s", args[1].Buf)
+	}
+
+	subcommand := args[0].Buf
+	bucketName := args[1].Buf
+	bucket := sh.DB.Bucket(bucketName)
+
+	switch subcommand {
+	case "set":
+		if len(args) != 3 {
+			return nil, fmt.Errorf("invalid arguments. 'schema set' requires 2 arguments")
+		}
+
+		if err := bucket.SetSchema(args[2].ToMustBytes()); err != nil {
+			return nil, err
+		}
+
+		return &Response{
+			Status: "ok",
+			Bucket: bucketName,
+		}, nil
+	case "get":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("invalid arguments. 'schema get' requires 1 argument")
+		}
+
+		schema, err := bucket.Schema()
+		if err != nil {
+			return nil, err
+		}
+
+		var body interface{}
+		if schema != nil {
+			if err := json.Unmarshal(schema, &body); err != nil {
+				return nil, err
+			}
+		}
+
+		return &Response{
+			Status: "ok",
+			Bucket: bucketName,
+			Body:   body,
+		}, nil
+	case "drop":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("invalid arguments. 'schema drop' requires 1 argument")
+		}
+
+		if err := bucket.DropSchema(); err != nil {
+			return nil, err
+		}
+
+		return &Response{
+			Status: "ok",
+			Bucket: bucketName,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported subcommand: schema %s", subcommand)
+}
+
+// buildQuery builds a query from the arguments of the select command.
+func buildQuery(sh *Shell, args []*Token) (*bucketstore.Query, string, error) {
 	// parse options
 	var limit uint64
 	var offset uint64
@@ -305,6 +464,8 @@ func doSelect(sh *Shell, args []*Token) (*Response, error) {
 	var max *Token
 	var order bucketstore.OrderBy = bucketstore.OrderByAsc
 	var prop string
+	var sortBy []bucketstore.SortKey
+	var after string
 
 	var removedIndexes = []int{}
 	for i, token := range args {
@@ -313,7 +474,7 @@ func doSelect(sh *Shell, args []*Token) (*Response, error) {
 			case strings.HasPrefix(token.Buf, "--limit"):
 				ui, err := strconv.ParseUint(args[i + 1].Buf, 0, 64)
 				if err != nil {
-					return nil, err
+					return nil, "", err
 				}
 
 				limit = ui
@@ -321,7 +482,7 @@ func doSelect(sh *Shell, args []*Token) (*Response, error) {
 			case strings.HasPrefix(token.Buf, "--offset"):
 				ui, err := strconv.ParseUint(args[i + 1].Buf, 0, 64)
 				if err != nil {
-					return nil, err
+					return nil, "", err
 				}
 
 				offset = ui
@@ -329,20 +490,20 @@ func doSelect(sh *Shell, args []*Token) (*Response, error) {
 			case strings.HasPrefix(token.Buf, "--filter"):
 				filter = args[i + 1].Buf
 				if filter == "" {
-					return nil, fmt.Errorf("requires filter value")
+					return nil, "", fmt.Errorf("requires filter value")
 				}
 				removedIndexes = append(removedIndexes, i)
 			case strings.HasPrefix(token.Buf, "--prefix"):
 				prefix = args[i + 1]
 				if prefix == nil {
-					return nil, fmt.Errorf("requires prefix value")
+					return nil, "", fmt.Errorf("requires prefix value")
 				}
 
 				removedIndexes = append(removedIndexes, i)
 			case strings.HasPrefix(token.Buf, "--match"):
 				match = args[i + 1]
 				if match == nil {
-					return nil, fmt.Errorf("requires match value")
+					return nil, "", fmt.Errorf("requires match value")
 				}
 
 				removedIndexes = append(removedIndexes, i)
@@ -350,7 +511,7 @@ func doSelect(sh *Shell, args []*Token) (*Response, error) {
 				min = args[i + 1]
 
 				if min == nil {
-					return nil, fmt.Errorf("requires min value")
+					return nil, "", fmt.Errorf("requires min value")
 				}
 
 				removedIndexes = append(removedIndexes, i)
@@ -358,7 +519,7 @@ func doSelect(sh *Shell, args []*Token) (*Response, error) {
 				max = args[i + 1]
 
 				if max == nil {
-					return nil, fmt.Errorf("requires max value")
+					return nil, "", fmt.Errorf("requires max value")
 				}
 
 				removedIndexes = append(removedIndexes, i)
@@ -366,7 +527,7 @@ func doSelect(sh *Shell, args []*Token) (*Response, error) {
 				o := args[i + 1].Buf
 
 				if o == "" {
-					return nil, fmt.Errorf("requires orderby value")
+					return nil, "", fmt.Errorf("requires orderby value")
 				}
 
 				if o == "desc" {
@@ -374,7 +535,7 @@ func doSelect(sh *Shell, args []*Token) (*Response, error) {
 				} else if o == "asc" {
 					order = bucketstore.OrderByAsc
 				} else {
-					return nil, fmt.Errorf("invalid order value")
+					return nil, "", fmt.Errorf("invalid order value")
 				}
 
 				removedIndexes = append(removedIndexes, i)
@@ -382,12 +543,28 @@ func doSelect(sh *Shell, args []*Token) (*Response, error) {
 				prop = args[i + 1].Buf
 
 				if prop == "" {
-					return nil, fmt.Errorf("requires prop value")
+					return nil, "", fmt.Errorf("requires prop value")
+				}
+
+				removedIndexes = append(removedIndexes, i)
+			case strings.HasPrefix(token.Buf, "--sort"):
+				s, err := parseSortBy(args[i + 1].Buf)
+				if err != nil {
+					return nil, "", err
+				}
+
+				sortBy = s
+				removedIndexes = append(removedIndexes, i)
+			case strings.HasPrefix(token.Buf, "--after"):
+				after = args[i + 1].Buf
+
+				if after == "" {
+					return nil, "", fmt.Errorf("requires after value")
 				}
 
 				removedIndexes = append(removedIndexes, i)
 			default:
-				return nil, fmt.Errorf("invalid option %s", token.Buf)
+				return nil, "", fmt.Errorf("invalid option %s", token.Buf)
 			}
 		}
 	}
@@ -399,11 +576,11 @@ func doSelect(sh *Shell, args []*Token) (*Response, error) {
 	}
 
 	if len(args) < 1 {
-		return nil, fmt.Errorf("invalid arguments")
+		return nil, "", fmt.Errorf("invalid arguments")
 	}
 
 	if args[0].DataType != DataTypeString {
-		return nil, fmt.Errorf("invalid arguments")
+		return nil, "", fmt.Errorf("invalid arguments")
 	}
 	bucketName := args[0].Buf
 
@@ -418,10 +595,18 @@ func doSelect(sh *Shell, args []*Token) (*Response, error) {
 		q.Offset = offset
 	}
 
+	if sortBy != nil {
+		q.SortBy = sortBy
+	}
+
+	if after != "" {
+		q.After = after
+	}
+
 	if filter != "" {
 		if filter == "keyPrefix" {
 			if prefix == nil {
-				return nil, fmt.Errorf("keyPrefix filter requires prefix")
+				return nil, "", fmt.Errorf("keyPrefix filter requires prefix")
 			}
 
 			q.Filter = &bucketstore.KeyPrefixFilter{
@@ -430,7 +615,7 @@ func doSelect(sh *Shell, args []*Token) (*Response, error) {
 			}
 		} else if filter == "keyRange" {
 			if min == nil || max == nil {
-				return nil, fmt.Errorf("keyRange filter requires min and max")
+				return nil, "", fmt.Errorf("keyRange filter requires min and max")
 			}
 
 			q.Filter = &bucketstore.KeyRangeFilter{
@@ -440,10 +625,10 @@ func doSelect(sh *Shell, args []*Token) (*Response, error) {
 			}
 		} else if filter == "propValueMatch" {
 			if prop == "" {
-				return nil, fmt.Errorf("propValuePrefix filter requires prop")
+				return nil, "", fmt.Errorf("propValuePrefix filter requires prop")
 			}
 			if match == nil {
-				return nil, fmt.Errorf("propValuePrefix filter requires match")
+				return nil, "", fmt.Errorf("propValuePrefix filter requires match")
 			}
 
 			q.Filter = &bucketstore.PropValueMatchFilter{
@@ -454,10 +639,10 @@ func doSelect(sh *Shell, args []*Token) (*Response, error) {
 
 		} else if filter == "propValuePrefix" {
 			if prop == "" {
-				return nil, fmt.Errorf("propValuePrefix filter requires prop")
+				return nil, "", fmt.Errorf("propValuePrefix filter requires prop")
 			}
 			if prefix == nil {
-				return nil, fmt.Errorf("propValuePrefix filter requires prefix")
+				return nil, "", fmt.Errorf("propValuePrefix filter requires prefix")
 			}
 
 			q.Filter = &bucketstore.PropValuePrefixFilter{
@@ -468,10 +653,10 @@ func doSelect(sh *Shell, args []*Token) (*Response, error) {
 
 		} else if filter == "propValueRange" {
 			if prop == "" {
-				return nil, fmt.Errorf("propValueRange filter requires prop")
+				return nil, "", fmt.Errorf("propValueRange filter requires prop")
 			}
 			if min == nil || max == nil {
-				return nil, fmt.Errorf("propValueRange filter requires min and max")
+				return nil, "", fmt.Errorf("propValueRange filter requires min and max")
 			}
 
 			q.Filter = &bucketstore.PropValueRangeFilter{
@@ -481,7 +666,7 @@ func doSelect(sh *Shell, args []*Token) (*Response, error) {
 				OrderBy: order,
 			}
 		} else {
-			return nil, fmt.Errorf("invalid filter")
+			return nil, "", fmt.Errorf("invalid filter")
 		}
 	} else {
 		q.Filter = &bucketstore.OrderByFilter{
@@ -489,34 +674,150 @@ func doSelect(sh *Shell, args []*Token) (*Response, error) {
 		}
 	}
 
-	items, err := q.AsList()
-	if err != nil {
+	return q, bucketName, nil
+}
+
+func newResponseItem(key []byte, value []byte) map[string]interface{} {
+	responseItem := map[string]interface{}{}
+
+	responseItem["key"] = "0x" + hex.EncodeToString(key)
+
+	jsonValue, err := decodeJSONValue(value)
+	if err == nil {
+		responseItem["value"] = jsonValue
+	} else {
+		responseItem["value"] = value
+	}
+
+	return responseItem
+}
+
+// decodeJSONValue decodes the JSON value with json.Number to display large integers exactly.
+func decodeJSONValue(value []byte) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
 		return nil, err
 	}
 
-	responseBody := []map[string]interface{}{}
+	if dec.More() {
+		return nil, fmt.Errorf("invalid character after top-level value")
+	}
 
-	for _, item := range items {
-		responseItem := map[string]interface{}{}
+	return v, nil
+}
 
-		responseItem["key"] = "0x" + hex.EncodeToString(item.Key)
-		jsonValue := map[string]interface{}{}
-		err = json.Unmarshal(item.Value, &jsonValue)
-		if err == nil {
-			responseItem["value"] = jsonValue
-		} else {
-			responseItem["value"] = item.Value
+// parseSortBy parses the sort option like "age desc, name asc".
+func parseSortBy(s string) ([]bucketstore.SortKey, error) {
+	sortBy := []bucketstore.SortKey{}
+
+	for _, part := range strings.Split(s, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("invalid sort value: %s", s)
+		}
+
+		sortKey := bucketstore.SortKey{
+			Property: fields[0],
+			OrderBy:  bucketstore.OrderByAsc,
+		}
+
+		if len(fields) == 2 {
+			if fields[1] == "desc" {
+				sortKey.OrderBy = bucketstore.OrderByDesc
+			} else if fields[1] != "asc" {
+				return nil, fmt.Errorf("invalid order value: %s", fields[1])
+			}
+		}
+
+		sortBy = append(sortBy, sortKey)
+	}
+
+	return sortBy, nil
+}
+
+func doCheck(sh *Shell, args []*Token) (*Response, error) {
+	for _, token := range args {
+		if token.DataType == DataTypeTerm && strings.HasPrefix(token.Buf, "-") {
+			switch {
+			default:
+				return nil, fmt.Errorf("unsupported option: %s", token.Buf)
+			}
 		}
+	}
 
-		responseBody = append(responseBody, responseItem)
+	if len(args) != 1 {
+		return nil, fmt.Errorf("invalid arguments. 'check' requires 1 argument")
+	}
+
+	if args[0].DataType != DataTypeString {
+		return nil, fmt.Errorf("the bucket name must be string: %s", args[0].Buf)
+	}
+
+	bucketName := args[0].Buf
+
+	report, err := sh.DB.CheckIndexes(bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	// index keys are binary, so outputs only the index names and the keys of the items.
+	entries := func(entries []*bucketstore.IndexEntry) []map[string]string {
+		ret := []map[string]string{}
+		for _, e := range entries {
+			ret = append(ret, map[string]string{"index": e.Index, "key": string(e.Ref)})
+		}
+		return ret
 	}
 
 	res := &Response{
 		Status: "ok",
 		Bucket: bucketName,
-		Count:  uint64(len(items)),
-		Body:   responseBody,
+		Body: map[string]interface{}{
+			"ok":                    report.OK(),
+			"missing_index_bucket":  report.MissingIndexBucket,
+			"missing_index_buckets": report.MissingIndexBuckets,
+			"orphaned":              entries(report.Orphaned),
+			"missing":               entries(report.Missing),
+		},
+	}
+
+	if !report.OK() {
+		res.Message = fmt.Sprintf("the indexes are broken. run 'reindex %s' to repair them.", bucketName)
 	}
 
 	return res, nil
 }
+
+func doReindex(sh *Shell, args []*Token) (*Response, error) {
+	for _, token := range args {
+		if token.DataType == DataTypeTerm && strings.HasPrefix(token.Buf, "-") {
+			switch {
+			default:
+				return nil, fmt.Errorf("unsupported option: %s", token.Buf)
+			}
+		}
+	}
+
+	if len(args) != 1 {
+		return nil, fmt.Errorf("invalid arguments. 'reindex' requires 1 argument")
+	}
+
+	if args[0].DataType != DataTypeString {
+		return nil, fmt.Errorf("the bucket name must be string: %s", args[0].Buf)
+	}
+
+	bucketName := args[0].Buf
+
+	n, err := sh.DB.RebuildIndexes(bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		Status: "ok",
+		Bucket: bucketName,
+		Count:  countOf(uint64(n)),
+	}, nil
+}
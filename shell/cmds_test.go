@@ -0,0 +1,33 @@
+package shell
+
+import (
+	"github.com/kohkimakimoto/bucketstore"
+	"testing"
+)
+
+func TestParseSortBy(t *testing.T) {
+	sortBy, err := parseSortBy("age desc, name asc,class")
+	if err != nil {
+		t.Errorf("Got a err: %v", err)
+	}
+
+	if len(sortBy) != 3 {
+		t.Fatalf("invalid sort keys: %v", sortBy)
+	}
+
+	if sortBy[0].Property != "age" || sortBy[0].OrderBy != bucketstore.OrderByDesc {
+		t.Errorf("invalid sort key: %v", sortBy[0])
+	}
+
+	if sortBy[1].Property != "name" || sortBy[1].OrderBy != bucketstore.OrderByAsc {
+		t.Errorf("invalid sort key: %v", sortBy[1])
+	}
+
+	if sortBy[2].Property != "class" || sortBy[2].OrderBy != bucketstore.OrderByAsc {
+		t.Errorf("invalid sort key: %v", sortBy[2])
+	}
+
+	if _, err := parseSortBy("age down"); err == nil {
+		t.Errorf("should raise error")
+	}
+}
@@ -14,6 +14,8 @@ Commands:
   buckets                         List all buckets.
 
   put <bucket> <key> <value>      Put a key/value pair item in a bucket.
+  patch <bucket> <key> <patch>    Partially update a item by a JSON Patch (array)
+                                  or a JSON Merge Patch (object).
   post <bucket> <value>           Post a key/value pair item in a bucket
                                   using key that is generated by autoincrementing sequence.
   get <bucket> <key>              Get a item of the key from a bucket.
@@ -21,8 +23,18 @@ Commands:
   delete bucket <bucket>          Delete a bucket.
 
   select <bucket> <options...>    List items in the bucket.
+                                  Items are output as json lines one by one
+                                  and the count is output at the end.
+                                  The response has the token to get the next page.
                                   This command can have some options.
                                   Please see the "Select command options" section.
+  count <bucket> <options...>     Count items in the bucket.
+                                  This command can have the same options as "select".
+  schema set <bucket> <schema>    Set a JSON Schema to validate items put in a bucket.
+  schema get <bucket>             Get the JSON Schema of a bucket.
+  schema drop <bucket>            Drop the JSON Schema of a bucket.
+  check <bucket>                  Check that the indexes of a bucket are consistent with the items.
+  reindex <bucket>                Rebuild the indexes of a bucket.
 
 Global options:
   -p      Output indented json response.
@@ -32,10 +44,15 @@ Select command options:
   --limit <number>       Limit of items to get.
   --filter <filter>      Filter of selection
   --orderby asc|desc     Sort order.
+  --prop <property>      Property name to filter. A nested property can be
+                         specified by a dotted path like 'address.city'.
+  --sort <sort>          Sort by properties independent of the filter.
+                         It is a comma separated list of '<property> [asc|desc]'.
   --prefix <prefix>      Prefix string.
   --match <match>        Match string or number.
   --min <min>            Min string or number.
   --max <max>            Max string or nubmer.
+  --after <token>        Token of the previous select to get the next page.
 
 Examples:
   Post animals to the "zoo" bucket.
@@ -65,6 +82,27 @@ Examples:
 
     > select 'zoo' --filter propValueMatch --prop 'class' --match 'lion' --limit 1 -p
 
+  Select lions sorted by age descending and name
+
+    > select 'zoo' --filter propValueMatch --prop 'class' --match 'lion' --sort 'age desc, name' -p
+
+  Select the next page of lions by the token of the previous select
+
+    > select 'zoo' --filter propValueMatch --prop 'class' --match 'lion' --limit 1 --after 'aQ...' -p
+
+  Count lions
+
+    > count 'zoo' --filter propValueMatch --prop 'class' --match 'lion'
+
+  Require animals to have a name
+
+    > schema set 'zoo' '{"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}}}'
+
+  Change the age of a animal
+
+    > patch 'zoo' 1 '{"age": 6}'
+    > patch 'zoo' 1 '[{"op": "replace", "path": "/age", "value": 6}]'
+
   Delete a animal from the zoo.
 
     > delete 'zoo' 1
@@ -2,8 +2,14 @@ package shell
 
 type Response struct {
 	Status string      `json:"status"`
-	Count  uint64      `json:"count,omitempty"`
+	Count  *uint64     `json:"count,omitempty"`
 	Bucket string      `json:"bucket,omitempty"`
 	Message string      `json:"message,omitempty"`
+	Token  string      `json:"token,omitempty"`
 	Body   interface{} `json:"body,omitempty"`
 }
+
+// countOf returns a pointer of the count to output zero as well.
+func countOf(count uint64) *uint64 {
+	return &count
+}
@@ -17,6 +17,7 @@ type Shell struct {
 	Path    string
 	Options *bucketstore.Options
 	exit    bool
+	pretty  bool
 	Stdin   *os.File
 	Stdout  *os.File
 	Stderr  *os.File
@@ -157,6 +158,8 @@ func (sh *Shell) ExecCommand(line string) error {
 		tokens = append(tokens[:removedI], tokens[removedI+1:]...)
 	}
 
+	sh.pretty = pretty
+
 	defer func() {
 		if err := recover(); err != nil {
 			sh.outputError(fmt.Sprintf("%v", err), pretty)
@@ -212,3 +215,20 @@ func (sh *Shell) output(res *Response, pretty bool) {
 
 	fmt.Fprintln(sh.Stdout, string(b))
 }
+
+// outputLine outputs a json line while a command is running.
+func (sh *Shell) outputLine(v interface{}) error {
+	var b []byte
+	var err error
+	if sh.pretty {
+		b, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		b, err = json.Marshal(v)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(sh.Stdout, string(b))
+	return err
+}
@@ -0,0 +1,388 @@
+package bucketstore
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// SortKey is a property path and a direction to sort query results.
+// The values are sorted in the same order as the index, so the values of different types are ordered by the type:
+// booleans, strings, numbers, null, and then integers of the property declared by AddIntegerIndex.
+// For instance, 1.5 of an integer property is placed before all integers.
+type SortKey struct {
+	Property string
+	OrderBy  OrderBy
+}
+
+// sortedForEach iterates items sorted by the SortBy option of the query.
+// If the query is sorted by a single indexed property, it walks the index by IndexCursor.
+// Otherwise it sorts all items matching the filter in memory.
+// Items that don't have the property are placed after the items that have it.
+func (q *Query) sortedForEach(bucket *BaseBucket, fn func(*Item) error) error {
+	if len(q.SortBy) == 1 {
+		sortKey := q.SortBy[0]
+
+		// the index in an old format or being rebuilt is not used to sort.
+		if bucket.getIndexBucket(sortKey.Property) != nil && bucket.checkIndexReadable() == nil {
+			switch filter := q.Filter.(type) {
+			case *OrderByFilter:
+				return indexSortedForEach(q, bucket, sortKey, fn)
+			case *PropValueMatchFilter:
+				if filter.Property == sortKey.Property {
+					f := *filter
+					f.OrderBy = sortKey.OrderBy
+					return f.forEach(q, bucket, fn)
+				}
+			case *PropValuePrefixFilter:
+				if filter.Property == sortKey.Property {
+					f := *filter
+					f.OrderBy = sortKey.OrderBy
+					return f.forEach(q, bucket, fn)
+				}
+			case *PropValueRangeFilter:
+				if filter.Property == sortKey.Property {
+					f := *filter
+					f.OrderBy = sortKey.OrderBy
+					return f.forEach(q, bucket, fn)
+				}
+			}
+		}
+	}
+
+	sorted, err := memorySortedItems(q, bucket)
+	if err != nil {
+		return err
+	}
+
+	return eachItem(limitItems(q, sorted), fn)
+}
+
+func indexSortedForEach(query *Query, bucket *BaseBucket, sortKey SortKey, fn func(*Item) error) error {
+	config, err := bucket.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	ic := bucket.IndexCursor(sortKey.Property)
+
+	var order = sortKey.OrderBy
+
+	// the position to resume is an index key while walking the index,
+	// and is an item key while walking items that don't have the property.
+	var afterIndex, afterKey []byte
+	if query.after != nil {
+		switch query.after.positionType {
+		case positionTypeIndex:
+			afterIndex = query.after.key
+		case positionTypeKey:
+			afterKey = query.after.key
+		default:
+			return fmt.Errorf("the token is not for this query")
+		}
+	}
+
+	var offset = query.Offset
+	var limit = uint64(0)
+
+	if query.Limit != 0 {
+		limit = offset + query.Limit
+	}
+
+	var counter uint64 = 0
+
+	// any value of the property matches.
+	matched := func(vt byte, vb []byte) bool {
+		return true
+	}
+
+	if afterKey == nil {
+		begin := beginIndexCursor(ic, afterIndex, order, func() *Index {
+			if order == OrderByDesc {
+				return ic.Last()
+			}
+			return ic.First()
+		})
+
+		for idx := begin; idx != nil; idx = nextIndex(ic, order) {
+			if foundBefore(idx, order, matched) {
+				continue
+			}
+
+			if offset <= counter {
+				if err := fn(indexItem(query, idx)); err != nil {
+					return err
+				}
+			}
+
+			counter++
+
+			if limit != 0 {
+				if limit <= counter {
+					return nil
+				}
+			}
+		}
+	}
+
+	if limit != 0 && limit <= counter {
+		return nil
+	}
+
+	// items that don't have the property.
+	// it reads all items of the bucket to find them.
+	c := bucket.Cursor()
+	for k, v := beginCursor(c, afterKey, OrderByAsc, c.First); k != nil; k, v = c.Next() {
+		// the items that have the property have been found by the index.
+		if hasSortValue(config, v, sortKey) {
+			continue
+		}
+
+		if offset <= counter {
+			if err := fn(&Item{Key: k, Value: v}); err != nil {
+				return err
+			}
+		}
+
+		counter++
+
+		if limit != 0 {
+			if limit <= counter {
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+func hasSortValue(config *IndexConfig, value []byte, sortKey SortKey) bool {
+	var jsonMap map[string]interface{}
+	if err := decodeJSON(value, &jsonMap); err != nil {
+		return false
+	}
+
+	return sortValue(config, sortKey.Property, flattenProperties(jsonMap)[sortKey.Property], sortKey.OrderBy) != nil
+}
+
+func nextIndex(ic *IndexCursor, order OrderBy) *Index {
+	if order == OrderByDesc {
+		return ic.Prev()
+	}
+
+	return ic.Next()
+}
+
+type sortableItem struct {
+	item *Item
+	// values are index bytes (<valueType> + <value>) of the sort properties.
+	// nil means the item doesn't have the property.
+	values [][]byte
+}
+
+// position encodes the sort values and the key to the position of the pagination token.
+//
+//   's' + (0x00 | 0x01 + <length:4 bytes> + <value>)... + <key>
+func (si *sortableItem) position() []byte {
+	p := []byte{positionTypeSorted}
+	for _, v := range si.values {
+		if v == nil {
+			p = append(p, 0x00)
+			continue
+		}
+
+		l := make([]byte, 4)
+		binary.BigEndian.PutUint32(l, uint32(len(v)))
+		p = append(append(append(p, 0x01), l...), v...)
+	}
+
+	return append(p, si.item.Key...)
+}
+
+func decodeSortedPosition(p []byte, n int) (*sortableItem, error) {
+	si := &sortableItem{values: make([][]byte, n)}
+	for i := 0; i < n; i++ {
+		if len(p) < 1 {
+			return nil, fmt.Errorf("the token is not for this query")
+		}
+
+		if p[0] == 0x00 {
+			p = p[1:]
+			continue
+		}
+
+		if len(p) < 5 {
+			return nil, fmt.Errorf("the token is not for this query")
+		}
+
+		l := int(binary.BigEndian.Uint32(p[1:5]))
+		if len(p) < 5+l {
+			return nil, fmt.Errorf("the token is not for this query")
+		}
+
+		si.values[i] = p[5 : 5+l]
+		p = p[5+l:]
+	}
+
+	si.item = &Item{Key: p}
+	return si, nil
+}
+
+type sortableItems struct {
+	items  []*sortableItem
+	sortBy []SortKey
+}
+
+func (s *sortableItems) Len() int      { return len(s.items) }
+func (s *sortableItems) Swap(i, j int) { s.items[i], s.items[j] = s.items[j], s.items[i] }
+func (s *sortableItems) Less(i, j int) bool {
+	return s.less(s.items[i], s.items[j])
+}
+
+func (s *sortableItems) less(x, y *sortableItem) bool {
+	for n, sortKey := range s.sortBy {
+		a := x.values[n]
+		b := y.values[n]
+
+		if a == nil || b == nil {
+			if a == nil && b == nil {
+				continue
+			}
+			// missing values are always placed last.
+			return b == nil
+		}
+
+		cmp := bytes.Compare(a, b)
+		if cmp == 0 {
+			continue
+		}
+
+		if sortKey.OrderBy == OrderByDesc {
+			return cmp > 0
+		}
+		return cmp < 0
+	}
+
+	// the items that have the same values are ordered by the key.
+	return bytes.Compare(x.item.Key, y.item.Key) < 0
+}
+
+// memorySortedItems sorts the items matching the filter in memory and removes the items before the position of the query.
+// If the query has the limit, it keeps only the first offset+limit items in a heap while walking the items.
+func memorySortedItems(query *Query, bucket *BaseBucket) ([]*Item, error) {
+	config, err := bucket.IndexConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := query.afterPosition(positionTypeSorted)
+	if err != nil {
+		return nil, err
+	}
+
+	var afterItem *sortableItem
+	if after != nil {
+		afterItem, err = decodeSortedPosition(after, len(query.SortBy))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var size uint64 = 0
+	if query.Limit != 0 {
+		size = query.Offset + query.Limit
+	}
+
+	s := &sortableItems{
+		items:  []*sortableItem{},
+		sortBy: query.SortBy,
+	}
+	h := &sortableItemsHeap{s}
+
+	err = query.Filter.forEach(&Query{}, bucket, func(item *Item) error {
+		var jsonMap map[string]interface{}
+		decodeJSON(item.Value, &jsonMap)
+		props := flattenProperties(jsonMap)
+
+		values := make([][]byte, len(query.SortBy))
+		for n, sortKey := range query.SortBy {
+			values[n] = sortValue(config, sortKey.Property, props[sortKey.Property], sortKey.OrderBy)
+		}
+
+		si := &sortableItem{item: item, values: values}
+		if afterItem != nil && !s.less(afterItem, si) {
+			return nil
+		}
+
+		if size == 0 {
+			s.items = append(s.items, si)
+		} else if uint64(len(s.items)) < size {
+			heap.Push(h, si)
+		} else if s.less(si, s.items[0]) {
+			// replaces the last item of the kept items.
+			s.items[0] = si
+			heap.Fix(h, 0)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(s)
+
+	sorted := make([]*Item, 0, len(s.items))
+	for _, si := range s.items {
+		sorted = append(sorted, &Item{Key: si.item.Key, Value: si.item.Value, position: si.position()})
+	}
+
+	return sorted, nil
+}
+
+// sortableItemsHeap is a heap of the sortable items whose top is the last item in the sorted order.
+type sortableItemsHeap struct {
+	*sortableItems
+}
+
+func (h *sortableItemsHeap) Less(i, j int) bool {
+	return h.less(h.items[j], h.items[i])
+}
+
+func (h *sortableItemsHeap) Push(x interface{}) {
+	h.items = append(h.items, x.(*sortableItem))
+}
+
+func (h *sortableItemsHeap) Pop() interface{} {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+// sortValue gets the index bytes of the property value to sort.
+// If the property is an array, it uses the least element in the ascending order
+// and the greatest element in the descending order.
+func sortValue(config *IndexConfig, propName string, values []interface{}, order OrderBy) []byte {
+	var ret []byte
+	for _, v := range values {
+		valueBytes, valueType := toIndexedBytes(config.indexValue(propName, v))
+		if valueType == valueTypeNoIndex {
+			continue
+		}
+
+		b := append([]byte{valueType}, valueBytes...)
+		if ret == nil {
+			ret = b
+			continue
+		}
+
+		cmp := bytes.Compare(b, ret)
+		if (order == OrderByDesc && cmp > 0) || (order != OrderByDesc && cmp < 0) {
+			ret = b
+		}
+	}
+
+	return ret
+}
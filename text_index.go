@@ -0,0 +1,433 @@
+package bucketstore
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/kohkimakimoto/bucketstore/v/bolt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+//
+// # Text index key specification.
+//
+// A text index is an inverted index stored in the index bucket named by textIndexName.
+// The key is a term and the key of the item, and the value is the term frequency in the item.
+//
+//   <term> + <sep1> + <sep2> + <key> : <term frequency:8 bytes>
+//
+
+// textIndexPrefix is a prefix of the names of text index buckets.
+// Property names starting with '_' are never indexed, so it doesn't conflict with them.
+const textIndexPrefix = "_text:"
+
+func textIndexName(propName string) string {
+	return textIndexPrefix + propName
+}
+
+func isTextIndexName(name string) bool {
+	return strings.HasPrefix(name, textIndexPrefix)
+}
+
+// TextIndex is a declaration of a text index.
+type TextIndex struct {
+	Property string `json:"property"`
+	// CJKBigram splits CJK characters into overlapping bigrams.
+	// If it is false, a run of CJK characters is a term.
+	CJKBigram bool `json:"cjk_bigram,omitempty"`
+}
+
+// tokenize splits the text into lowercase terms on the boundaries of letters and numbers.
+func tokenize(text string, cjkBigram bool) []string {
+	terms := []string{}
+
+	var word []rune
+	var cjk []rune
+
+	flushWord := func() {
+		if len(word) > 0 {
+			terms = append(terms, string(word))
+			word = nil
+		}
+	}
+
+	flushCJK := func() {
+		if len(cjk) == 0 {
+			return
+		}
+
+		if cjkBigram && len(cjk) > 1 {
+			for i := 0; i < len(cjk)-1; i++ {
+				terms = append(terms, string(cjk[i:i+2]))
+			}
+		} else {
+			terms = append(terms, string(cjk))
+		}
+		cjk = nil
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.Is(unicode.Mn, r):
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+
+	flushWord()
+	flushCJK()
+
+	return terms
+}
+
+func isCJK(r rune) bool {
+	// the prolonged sound mark 'ー' belongs to the common script, but it is a part of katakana words.
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) || r == '\u30fc'
+}
+
+// termFrequencies counts the terms in the string values of the property.
+func termFrequencies(values []interface{}, cjkBigram bool) map[string]uint64 {
+	tf := map[string]uint64{}
+	for _, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+
+		for _, term := range tokenize(s, cjkBigram) {
+			tf[term]++
+		}
+	}
+
+	return tf
+}
+
+func genTextIndexKey(term string, key []byte) []byte {
+	return append(genTextIndexPrefix(term), key...)
+}
+
+func genTextIndexPrefix(term string) []byte {
+	return append([]byte(term), sep1, sep2)
+}
+
+// AddTextIndex declares the text index on the string property and creates the index of the existing items.
+func (b *BaseBucket) AddTextIndex(propName string, cjkBigram bool) error {
+	if propName == "" || isIgnorePattern(propName) {
+		return fmt.Errorf("invalid property name to index: %s", propName)
+	}
+
+	config, err := b.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	if config.textIndex(propName) != nil {
+		return nil
+	}
+
+	textIndex := &TextIndex{Property: propName, CJKBigram: cjkBigram}
+	config.Text = append(config.Text, textIndex)
+	if err := b.putIndexConfig(config); err != nil {
+		return err
+	}
+
+	if !b.isIndexable() {
+		return nil
+	}
+
+	return b.data.ForEach(func(key, value []byte) error {
+		var jsonMap map[string]interface{}
+		if err := decodeJSON(value, &jsonMap); err != nil {
+			return nil
+		}
+
+		return b.putTextIndex(textIndex, key, flattenProperties(jsonMap))
+	})
+}
+
+// DropTextIndex removes the declaration of the text index and deletes the index.
+func (b *BaseBucket) DropTextIndex(propName string) error {
+	config, err := b.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	if config.textIndex(propName) == nil {
+		return nil
+	}
+
+	text := []*TextIndex{}
+	for _, t := range config.Text {
+		if t.Property != propName {
+			text = append(text, t)
+		}
+	}
+
+	config.Text = text
+	if err := b.putIndexConfig(config); err != nil {
+		return err
+	}
+
+	if b.getIndexBucket(textIndexName(propName)) == nil {
+		return nil
+	}
+
+	return b.deleteIndexBucket(textIndexName(propName))
+}
+
+// refreshTextIndex replaces the text index keys of the item from the old value to the new value.
+// The old or new value can be nil.
+func (b *BaseBucket) refreshTextIndex(key []byte, oldJsonMap map[string]interface{}, jsonMap map[string]interface{}) error {
+	config, err := b.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	if len(config.Text) == 0 {
+		return nil
+	}
+
+	var oldProps, props map[string][]interface{}
+	if oldJsonMap != nil {
+		oldProps = flattenProperties(oldJsonMap)
+	}
+	if jsonMap != nil {
+		props = flattenProperties(jsonMap)
+	}
+
+	for _, textIndex := range config.Text {
+		if oldProps != nil && props != nil && reflect.DeepEqual(oldProps[textIndex.Property], props[textIndex.Property]) {
+			// unchanged.
+			continue
+		}
+
+		if oldProps != nil {
+			indexBucket := b.getIndexBucket(textIndexName(textIndex.Property))
+			if indexBucket != nil {
+				for term := range termFrequencies(oldProps[textIndex.Property], textIndex.CJKBigram) {
+					if err := indexBucket.Delete(genTextIndexKey(term, key)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		if props != nil {
+			if err := b.putTextIndex(textIndex, key, props); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (b *BaseBucket) putTextIndex(textIndex *TextIndex, key []byte, props map[string][]interface{}) error {
+	indexBucket, err := b.createIndexBucketIfNotExists(textIndexName(textIndex.Property))
+	if err != nil {
+		return err
+	}
+
+	for term, n := range termFrequencies(props[textIndex.Property], textIndex.CJKBigram) {
+		if err := indexBucket.Put(genTextIndexKey(term, key), Uint64ToBytes(n)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// termPostings gets the keys of the items that have the term and the term frequencies.
+func termPostings(indexBucket *bolt.Bucket, term string) map[string]uint64 {
+	postings := map[string]uint64{}
+
+	prefix := genTextIndexPrefix(term)
+	c := indexBucket.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		postings[string(k[len(prefix):])] = BytesToUint64(v)
+	}
+
+	return postings
+}
+
+// TextOperator is an operator to combine the terms of a text search.
+type TextOperator int
+
+const (
+	// TextOperatorAnd selects items that have all of the terms.
+	TextOperatorAnd TextOperator = 0
+	// TextOperatorOr selects items that have any of the terms.
+	TextOperatorOr TextOperator = 1
+)
+
+// TextSearchFilter selects items by the text index of the property.
+// The text is split into terms by the same tokenizer as the index.
+// The results are ranked by the sum of the term frequencies, and ordered by the key in the same rank.
+type TextSearchFilter struct {
+	Property string
+	Text     string
+	Operator TextOperator
+}
+
+func (filter *TextSearchFilter) forEach(query *Query, bucket *BaseBucket, fn func(*Item) error) error {
+	config, err := bucket.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	textIndex := config.textIndex(filter.Property)
+	if textIndex == nil {
+		// does not index.
+		return nil
+	}
+
+	indexBucket := bucket.getIndexBucket(textIndexName(filter.Property))
+	if indexBucket == nil {
+		return nil
+	}
+
+	terms := tokenize(filter.Text, textIndex.CJKBigram)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	scores := map[string]uint64{}
+	matches := map[string]int{}
+	seenTerms := map[string]bool{}
+	for _, term := range terms {
+		if seenTerms[term] {
+			continue
+		}
+		seenTerms[term] = true
+
+		for k, n := range termPostings(indexBucket, term) {
+			scores[k] += n
+			matches[k]++
+		}
+	}
+
+	ranked := []*rankedItem{}
+	for k, score := range scores {
+		if filter.Operator != TextOperatorOr && matches[k] != len(seenTerms) {
+			continue
+		}
+
+		ranked = append(ranked, &rankedItem{key: []byte(k), score: score})
+	}
+	sort.Sort(rankedItems(ranked))
+
+	ranked, err = rankedItemsAfter(query, ranked)
+	if err != nil {
+		return err
+	}
+
+	items := make([]*Item, 0, len(ranked))
+	for _, r := range ranked {
+		items = append(items, &Item{Key: r.key, position: r.position()})
+	}
+
+	for _, item := range limitItems(query, items) {
+		if !query.keysOnly {
+			item.Value = bucket.Get(item.Key)
+		}
+
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (filter *TextSearchFilter) match(bucket *BaseBucket, key []byte, value []byte) (bool, error) {
+	config, err := bucket.IndexConfig()
+	if err != nil {
+		return false, err
+	}
+
+	textIndex := config.textIndex(filter.Property)
+	if textIndex == nil {
+		return false, nil
+	}
+
+	indexBucket := bucket.getIndexBucket(textIndexName(filter.Property))
+	if indexBucket == nil {
+		return false, nil
+	}
+
+	terms := tokenize(filter.Text, textIndex.CJKBigram)
+	if len(terms) == 0 {
+		return false, nil
+	}
+
+	for _, term := range terms {
+		found := indexBucket.Get(genTextIndexKey(term, key)) != nil
+		if filter.Operator == TextOperatorOr && found {
+			return true, nil
+		}
+		if filter.Operator != TextOperatorOr && !found {
+			return false, nil
+		}
+	}
+
+	return filter.Operator != TextOperatorOr, nil
+}
+
+type rankedItem struct {
+	key   []byte
+	score uint64
+}
+
+// position encodes the score and the key to the position of the pagination token.
+//
+//	'r' + <score:8 bytes> + <key>
+func (r *rankedItem) position() []byte {
+	return append(append([]byte{positionTypeRanked}, Uint64ToBytes(r.score)...), r.key...)
+}
+
+type rankedItems []*rankedItem
+
+func (items rankedItems) Len() int      { return len(items) }
+func (items rankedItems) Swap(i, j int) { items[i], items[j] = items[j], items[i] }
+func (items rankedItems) Less(i, j int) bool {
+	return rankedLess(items[i], items[j])
+}
+
+func rankedLess(a, b *rankedItem) bool {
+	if a.score != b.score {
+		return a.score > b.score
+	}
+
+	return bytes.Compare(a.key, b.key) < 0
+}
+
+// rankedItemsAfter removes the items before the position of the query from the ranked items.
+func rankedItemsAfter(query *Query, items []*rankedItem) ([]*rankedItem, error) {
+	after, err := query.afterPosition(positionTypeRanked)
+	if err != nil {
+		return nil, err
+	}
+
+	if after == nil {
+		return items, nil
+	}
+
+	if len(after) < 8 {
+		return nil, fmt.Errorf("the token is not for this query")
+	}
+
+	afterItem := &rankedItem{score: BytesToUint64(after[:8]), key: after[8:]}
+	i := sort.Search(len(items), func(i int) bool {
+		return rankedLess(afterItem, items[i])
+	})
+
+	return items[i:], nil
+}
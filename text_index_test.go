@@ -0,0 +1,130 @@
+package bucketstore
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	cases := []struct {
+		text      string
+		cjkBigram bool
+		expected  []string
+	}{
+		{"Hello, World! 2 cats", false, []string{"hello", "world", "2", "cats"}},
+		{"Café-au-lait", false, []string{"café", "au", "lait"}},
+		{"東京タワー tower", false, []string{"東京タワー", "tower"}},
+		{"東京タワー tower", true, []string{"東京", "京タ", "タワ", "ワー", "tower"}},
+		{"東 x", true, []string{"東", "x"}},
+		{"  ", false, []string{}},
+	}
+
+	for _, c := range cases {
+		terms := tokenize(c.text, c.cjkBigram)
+		if !reflect.DeepEqual(terms, c.expected) {
+			t.Errorf("unmatch %q: %v (expected %v)", c.text, terms, c.expected)
+		}
+	}
+}
+
+func TestTextSearchFilter(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	bucket := db.Bucket("products")
+	bucket.PutRaw([]byte("key1"), []byte(`{"description": "A red apple. Apple pie is sweet."}`))
+
+	// the existing items are indexed.
+	if err := bucket.AddTextIndex("description", true); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	bucket.PutRaw([]byte("key2"), []byte(`{"description": "Green apple and red grape"}`))
+	bucket.PutRaw([]byte("key3"), []byte(`{"description": "Sweet grape juice 東京産"}`))
+	bucket.PutRaw([]byte("key4"), []byte(`{"description": "Banana"}`))
+	// updating the item replaces the index.
+	bucket.PutRaw([]byte("key4"), []byte(`{"description": "Banana apple"}`))
+	bucket.PutRaw([]byte("key5"), []byte(`{"description": "apple"}`))
+	bucket.Delete([]byte("key5"))
+
+	cases := []struct {
+		filter   *TextSearchFilter
+		expected []string
+	}{
+		{&TextSearchFilter{Property: "description", Text: "APPLE"}, []string{"key1", "key2", "key4"}},
+		{&TextSearchFilter{Property: "description", Text: "red apple"}, []string{"key1", "key2"}},
+		{&TextSearchFilter{Property: "description", Text: "sweet grape", Operator: TextOperatorOr}, []string{"key3", "key1", "key2"}},
+		{&TextSearchFilter{Property: "description", Text: "東京"}, []string{"key3"}},
+		{&TextSearchFilter{Property: "description", Text: "banana"}, []string{"key4"}},
+		{&TextSearchFilter{Property: "description", Text: "cherry"}, []string{}},
+		{&TextSearchFilter{Property: "name", Text: "apple"}, []string{}},
+	}
+
+	for i, c := range cases {
+		q := bucket.Query()
+		q.Filter = c.filter
+		items, err := q.AsList()
+		if err != nil {
+			t.Errorf("should not raise error: %v", err)
+		}
+
+		keys := []string{}
+		for _, item := range items {
+			if item.Value == nil {
+				t.Errorf("should have value: %s", item.Key)
+			}
+			keys = append(keys, string(item.Key))
+		}
+
+		if !reflect.DeepEqual(keys, c.expected) {
+			t.Errorf("unmatch case %d: %v (expected %v)", i, keys, c.expected)
+		}
+	}
+
+	// pagination
+	keys := []string{}
+	token := ""
+	for i := 0; i < 5; i++ {
+		q := bucket.Query()
+		q.Filter = &TextSearchFilter{Property: "description", Text: "apple"}
+		q.Limit = 2
+		q.After = token
+		items, err := q.AsList()
+		if err != nil {
+			t.Errorf("should not raise error: %v", err)
+		}
+		if len(items) == 0 {
+			break
+		}
+		for _, item := range items {
+			keys = append(keys, string(item.Key))
+		}
+		token = q.Token()
+	}
+	if !reflect.DeepEqual(keys, []string{"key1", "key2", "key4"}) {
+		t.Errorf("unmatch: %v", keys)
+	}
+
+	if err := bucket.DropTextIndex("description"); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	q := bucket.Query()
+	q.Filter = &TextSearchFilter{Property: "description", Text: "apple"}
+	if count, _ := q.Count(); count != 0 {
+		t.Errorf("should be 0: %d", count)
+	}
+}
@@ -0,0 +1,346 @@
+package bucketstore
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/kohkimakimoto/bucketstore/v/bolt"
+	"time"
+)
+
+//
+// # Expiry specification.
+//
+// The expiries of items are stored in the expiries bucket of the system area per bucket.
+// It has two buckets, one to look up the expiry by the key,
+// and the other to find expired items in the time order.
+//
+//   k: <key> : <expires at:8 bytes>
+//   t: <expires at:8 bytes> + <key> : (empty)
+//
+// <expires at> is the unix time in nanoseconds.
+//
+
+var (
+	bExpiryKeys  = []byte("k")
+	bExpiryTimes = []byte("t")
+)
+
+// timeNow gets the current time to check expiries. It is replaced in tests.
+var timeNow = time.Now
+
+// defaultReaperBatchSize is the number of expired items deleted in a write transaction by default.
+const defaultReaperBatchSize = 1000
+
+// PutWithTTL puts the item that expires after the ttl.
+// An expired item is treated as absent, and is deleted by the next write of the key or the reaper.
+// Putting the item by Put removes the expiry.
+func (b *BaseBucket) PutWithTTL(key []byte, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("ttl must be positive: %v", ttl)
+	}
+
+	if err := b.Put(key, value); err != nil {
+		return err
+	}
+
+	return b.setExpiry(key, timeNow().Add(ttl))
+}
+
+// ExpiresAt gets the time when the item expires.
+// It returns false if the item doesn't have an expiry.
+func (b *BaseBucket) ExpiresAt(key []byte) (time.Time, bool) {
+	keys := b.expiryBucket(bExpiryKeys)
+	if keys == nil {
+		return time.Time{}, false
+	}
+
+	v := keys.Get(key)
+	if v == nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, int64(BytesToUint64(v))), true
+}
+
+// isExpired checks whether the item has been expired at the time.
+func (b *BaseBucket) isExpired(key []byte, now time.Time) bool {
+	expiresAt, ok := b.ExpiresAt(key)
+	return ok && !now.Before(expiresAt)
+}
+
+// hasExpiries checks whether the bucket has any items that expire.
+func (b *BaseBucket) hasExpiries() bool {
+	times := b.expiryBucket(bExpiryTimes)
+	if times == nil {
+		return false
+	}
+
+	k, _ := times.Cursor().First()
+	return k != nil
+}
+
+// deleteIfExpired deletes the item if it has been expired,
+// so that writing the key starts from the absent item.
+func (b *BaseBucket) deleteIfExpired(key []byte) error {
+	if !b.isExpired(key, timeNow()) {
+		return nil
+	}
+
+	return b.expire(key)
+}
+
+// expire deletes the expired item. It is not deleted by the user,
+// so it doesn't run the hooks and is logged as ChangeTypeExpire.
+func (b *BaseBucket) expire(key []byte) error {
+	// copy the old value for the change log because it is only valid until the bucket is modified.
+	var before []byte
+	v := b.data.Get(key)
+	if v != nil && b.tx.changeLogEnabled() {
+		before = append([]byte{}, v...)
+	}
+
+	if err := b.deleteItem(key); err != nil {
+		return err
+	}
+
+	if v == nil {
+		// nothing is deleted.
+		return nil
+	}
+
+	return b.appendItemChange(ChangeTypeExpire, key, before, nil)
+}
+
+// DeleteExpired deletes the items expired at the time in the time order.
+// The hooks are not run for the expired items.
+// It deletes at most limit items if the limit is not 0, and returns the number of the deleted items.
+func (b *BaseBucket) DeleteExpired(now time.Time, limit int) (int, error) {
+	times := b.expiryBucket(bExpiryTimes)
+	if times == nil {
+		return 0, nil
+	}
+
+	// collect the keys at first because the bucket must not be modified while iterating.
+	keys := [][]byte{}
+	end := Uint64ToBytes(uint64(now.UnixNano()))
+	c := times.Cursor()
+	for k, _ := c.First(); k != nil && bytes.Compare(k[:8], end) <= 0; k, _ = c.Next() {
+		if limit != 0 && len(keys) >= limit {
+			break
+		}
+
+		keys = append(keys, append([]byte{}, k[8:]...))
+	}
+
+	for _, key := range keys {
+		if err := b.expire(key); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(keys), nil
+}
+
+func (b *BaseBucket) expiryBucket(name []byte) *bolt.Bucket {
+	// the database opened in the read only mode may not have the expiries bucket.
+	expiries := b.tx.bExpiries()
+	if expiries == nil {
+		return nil
+	}
+
+	bucket := expiries.Bucket(b.name)
+	if bucket == nil {
+		return nil
+	}
+
+	return bucket.Bucket(name)
+}
+
+func (b *BaseBucket) setExpiry(key []byte, expiresAt time.Time) error {
+	if err := b.clearExpiry(key); err != nil {
+		return err
+	}
+
+	bucket, err := b.tx.bExpiries().CreateBucketIfNotExists(b.name)
+	if err != nil {
+		return err
+	}
+
+	keys, err := bucket.CreateBucketIfNotExists(bExpiryKeys)
+	if err != nil {
+		return err
+	}
+
+	times, err := bucket.CreateBucketIfNotExists(bExpiryTimes)
+	if err != nil {
+		return err
+	}
+
+	t := Uint64ToBytes(uint64(expiresAt.UnixNano()))
+	if err := keys.Put(key, t); err != nil {
+		return err
+	}
+
+	return times.Put(append(t, key...), []byte{})
+}
+
+func (b *BaseBucket) clearExpiry(key []byte) error {
+	keys := b.expiryBucket(bExpiryKeys)
+	if keys == nil {
+		return nil
+	}
+
+	t := keys.Get(key)
+	if t == nil {
+		return nil
+	}
+
+	if err := b.expiryBucket(bExpiryTimes).Delete(append(append([]byte{}, t...), key...)); err != nil {
+		return err
+	}
+
+	return keys.Delete(key)
+}
+
+// countExpired counts the items expired at the time.
+func (b *BaseBucket) countExpired(now time.Time) uint64 {
+	times := b.expiryBucket(bExpiryTimes)
+	if times == nil {
+		return 0
+	}
+
+	var n uint64 = 0
+	end := Uint64ToBytes(uint64(now.UnixNano()))
+	c := times.Cursor()
+	for k, _ := c.First(); k != nil && bytes.Compare(k[:8], end) <= 0; k, _ = c.Next() {
+		n++
+	}
+
+	return n
+}
+
+// skipExpiredForEach runs the query without the expired items.
+// The filters count the offset and the limit before the expired items are skipped,
+// so it applies them to the unexpired items instead of the filters.
+// The filters are limited to the offset and the limit plus the number of the expired items,
+// that is enough to find the unexpired items in the limit.
+func (q *Query) skipExpiredForEach(bucket *BaseBucket, fn func(*Item) error) error {
+	now := timeNow()
+
+	eq := *q
+	eq.Offset = 0
+	if q.Limit != 0 {
+		eq.Limit = q.Offset + q.Limit + bucket.countExpired(now)
+	}
+
+	var counter uint64 = 0
+	err := eq.forEachItem(bucket, func(item *Item) error {
+		if bucket.isExpired(item.Key, now) {
+			return nil
+		}
+
+		counter++
+		if counter <= q.Offset {
+			return nil
+		}
+
+		if err := fn(item); err != nil {
+			return err
+		}
+
+		if q.Limit != 0 && counter >= q.Offset+q.Limit {
+			return errStopIteration
+		}
+
+		return nil
+	})
+	if err == errStopIteration {
+		err = nil
+	}
+
+	return err
+}
+
+// ReapExpired deletes the expired items of all buckets in batched write transactions.
+// It returns the number of the deleted items.
+func (db *DB) ReapExpired() (int, error) {
+	batchSize := db.options.ReaperBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultReaperBatchSize
+	}
+
+	names := []string{}
+	err := db.View(func(tx *Tx) error {
+		return tx.BucketNames(func(name string) error {
+			names = append(names, name)
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, name := range names {
+		for {
+			n := 0
+			err := db.Update(func(tx *Tx) error {
+				b, err := tx.baseBucket([]byte(name))
+				if err != nil {
+					return err
+				}
+
+				if b == nil {
+					return nil
+				}
+
+				n, err = b.DeleteExpired(timeNow(), batchSize)
+				return err
+			})
+			if err != nil {
+				return total, err
+			}
+
+			total += n
+			if n < batchSize {
+				break
+			}
+		}
+	}
+
+	return total, nil
+}
+
+// startReaper starts the goroutine to delete expired items periodically.
+func (db *DB) startReaper(interval time.Duration) {
+	db.reaperStop = make(chan struct{})
+	db.reaperDone = make(chan struct{})
+
+	go func() {
+		defer close(db.reaperDone)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				// an error is retried at the next tick.
+				db.ReapExpired()
+			case <-db.reaperStop:
+				return
+			}
+		}
+	}()
+}
+
+// stopReaper stops the reaper goroutine and waits for it.
+func (db *DB) stopReaper() {
+	if db.reaperStop == nil {
+		return
+	}
+
+	close(db.reaperStop)
+	<-db.reaperDone
+	db.reaperStop = nil
+}
@@ -0,0 +1,213 @@
+package bucketstore
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBucketPutWithTTL(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	bucket := db.Bucket("sessions")
+	bucket.PutRaw([]byte("key1"), []byte(`{"user": "joe"}`))
+	if err := bucket.PutWithTTL([]byte("key2"), []byte(`{"user": "foo"}`), time.Minute); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if err := bucket.PutWithTTL([]byte("key3"), []byte(`{"user": "coo"}`), time.Hour); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if err := bucket.PutWithTTL([]byte("key4"), []byte(`{"user": "boo"}`), 0); err == nil {
+		t.Errorf("should raise error")
+	}
+
+	if item, _ := bucket.Get([]byte("key2")); item == nil {
+		t.Errorf("should not be nil")
+	}
+
+	q := bucket.Query()
+	q.Filter = &PropValuePrefixFilter{Property: "user", Prefix: ""}
+	if count, _ := q.Count(); count != 3 {
+		t.Errorf("should be 3: %d", count)
+	}
+
+	// key2 is expired.
+	now = now.Add(2 * time.Minute)
+
+	if item, _ := bucket.Get([]byte("key2")); item != nil {
+		t.Errorf("should be nil: %v", item)
+	}
+	if v, _ := bucket.GetRaw([]byte("key2")); v != nil {
+		t.Errorf("should be nil: %s", v)
+	}
+
+	q = bucket.Query()
+	q.Filter = &PropValuePrefixFilter{Property: "user", Prefix: ""}
+	if count, _ := q.Count(); count != 2 {
+		t.Errorf("should be 2: %d", count)
+	}
+
+	// the offset and the limit are applied to the unexpired items.
+	q = bucket.Query()
+	q.Offset = 1
+	q.Limit = 1
+	items, err := q.AsList()
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if len(items) != 1 || string(items[0].Key) != "key3" {
+		t.Errorf("unmatch: %v", items)
+	}
+
+	// the sorted items are limited including the expired items.
+	q = bucket.Query()
+	q.SortBy = []SortKey{{Property: "user"}, {Property: "age"}}
+	q.Offset = 1
+	q.Limit = 1
+	items, err = q.AsList()
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if len(items) != 1 || string(items[0].Key) != "key1" {
+		t.Errorf("unmatch: %v", items)
+	}
+
+	// the expired item is absent for the conditional writes.
+	if err := bucket.PutIfAbsent([]byte("key2"), []byte(`{"user": "foo"}`)); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if item, _ := bucket.Get([]byte("key2")); item == nil || item.Revision != 1 {
+		t.Errorf("should be the revision 1: %v", item)
+	}
+
+	// Put removes the expiry.
+	now = now.Add(2 * time.Hour)
+	if item, _ := bucket.Get([]byte("key2")); item == nil {
+		t.Errorf("should not be nil")
+	}
+	if item, _ := bucket.Get([]byte("key3")); item != nil {
+		t.Errorf("should be nil: %v", item)
+	}
+
+	// the expired item still exists until it is reaped.
+	err = db.View(func(tx *Tx) error {
+		b, err := tx.Bucket("sessions")
+		if err != nil {
+			return err
+		}
+
+		if b.BaseBucket().Data().Get([]byte("key3")) == nil {
+			t.Errorf("should not be nil")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	n, err := db.ReapExpired()
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("should be 1: %d", n)
+	}
+
+	err = db.View(func(tx *Tx) error {
+		b, err := tx.Bucket("sessions")
+		if err != nil {
+			return err
+		}
+
+		if b.BaseBucket().Data().Get([]byte("key3")) != nil {
+			t.Errorf("should be nil")
+		}
+		if b.BaseBucket().hasExpiries() {
+			t.Errorf("should not have expiries")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	// the index of the reaped item is deleted.
+	ic := 0
+	err = db.View(func(tx *Tx) error {
+		b, _ := tx.Bucket("sessions")
+		idx := b.BaseBucket().IndexCursor("user").SeekFirst(ValueTypeString, []byte("coo"))
+		if idx != nil && string(idx.Key()) == "key3" {
+			ic++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if ic != 0 {
+		t.Errorf("the index should be deleted")
+	}
+}
+
+func TestReaper(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	options := NewOptions()
+	options.ReaperInterval = 10 * time.Millisecond
+	options.ReaperBatchSize = 2
+
+	db, err := Open(tmpFile.Name(), 0600, options)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	bucket := db.Bucket("caches")
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		bucket.PutWithTTL([]byte(k), []byte(`{}`), time.Millisecond)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var count int
+		db.View(func(tx *Tx) error {
+			b, _ := tx.Bucket("caches")
+			count = b.BaseBucket().Stats().KeyN
+			return nil
+		})
+
+		if count == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("the expired items are not reaped: %d", count)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -10,6 +10,8 @@ import (
 type Tx struct {
 	db         *DB
 	internalTx *bolt.Tx
+	// changed is true if the change log is written in the transaction.
+	changed bool
 }
 
 func newTx(ds *DB, t *bolt.Tx) *Tx {
@@ -44,7 +46,31 @@ func (tx *Tx) DeleteBucket(name string) error {
 		return err
 	}
 
-	return nil
+	if err := tx.bIndexConfig().Delete([]byte(name)); err != nil {
+		return err
+	}
+
+	if err := tx.bSchemas().Delete([]byte(name)); err != nil {
+		return err
+	}
+
+	if err := tx.bValueModes().Delete([]byte(name)); err != nil {
+		return err
+	}
+
+	if tx.bRevisions().Bucket([]byte(name)) != nil {
+		if err := tx.bRevisions().DeleteBucket([]byte(name)); err != nil {
+			return err
+		}
+	}
+
+	if tx.bExpiries().Bucket([]byte(name)) != nil {
+		if err := tx.bExpiries().DeleteBucket([]byte(name)); err != nil {
+			return err
+		}
+	}
+
+	return tx.appendChange(&ChangeEvent{Type: ChangeTypeDrop, Bucket: name})
 }
 
 func (tx *Tx) BucketNames(fn func(name string) error) error {
@@ -100,7 +126,7 @@ func (tx *Tx) baseBucket(name []byte) (*BaseBucket, error) {
 
 	index := tx.bIndex().Bucket(name)
 	if index == nil {
-		return nil, fmt.Errorf("the data structure was broken! not found the index bucket of %s.", string(name))
+		return nil, fmt.Errorf("the data structure was broken! not found the index bucket of %s. rebuild the indexes by DB.RebuildIndexes.", string(name))
 	}
 
 	return newBaseBucket(name, tx, data, index), nil
@@ -155,3 +181,27 @@ func (tx *Tx) bBucketsList() *bolt.Bucket {
 func (tx *Tx) bIndex() *bolt.Bucket {
 	return tx.internalTx.Bucket(bIndex)
 }
+
+func (tx *Tx) bIndexConfig() *bolt.Bucket {
+	return tx.internalTx.Bucket(bIndexConfig)
+}
+
+func (tx *Tx) bSchemas() *bolt.Bucket {
+	return tx.internalTx.Bucket(bSchemas)
+}
+
+func (tx *Tx) bValueModes() *bolt.Bucket {
+	return tx.internalTx.Bucket(bValueModes)
+}
+
+func (tx *Tx) bRevisions() *bolt.Bucket {
+	return tx.internalTx.Bucket(bRevisions)
+}
+
+func (tx *Tx) bExpiries() *bolt.Bucket {
+	return tx.internalTx.Bucket(bExpiries)
+}
+
+func (tx *Tx) bChanges() *bolt.Bucket {
+	return tx.internalTx.Bucket(bChanges)
+}
@@ -0,0 +1,137 @@
+package bucketstore
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// ErrUniqueViolation is returned when putting an item violates a unique index constraint.
+type ErrUniqueViolation struct {
+	// Property is the property path of the unique index.
+	Property string
+	// Value is the duplicated value of the property.
+	Value interface{}
+	// Key is the key of the existing item that has the same value.
+	Key []byte
+}
+
+func (e *ErrUniqueViolation) Error() string {
+	return fmt.Sprintf("unique constraint violation: the value %v of the property '%s' is already used by the item %q", e.Value, e.Property, string(e.Key))
+}
+
+// AddUniqueIndex declares the property to be indexed with a unique constraint.
+// It returns ErrUniqueViolation if the existing items have duplicated values of the property.
+// JSON null values are not constrained.
+func (b *BaseBucket) AddUniqueIndex(propName string) error {
+	if propName == "" || isIgnorePattern(propName) {
+		return fmt.Errorf("invalid property name to index: %s", propName)
+	}
+
+	config, err := b.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	if config.isUnique(propName) {
+		return nil
+	}
+
+	// check the existing items before changing anything.
+	// the items in the other modes are checked when the bucket is changed to the json-object mode.
+	if b.isIndexable() {
+		if err := b.checkExistingUnique(propName); err != nil {
+			return err
+		}
+	}
+
+	if err := b.AddIndex(propName); err != nil {
+		return err
+	}
+
+	config.Unique = append(config.Unique, propName)
+	return b.putIndexConfig(config)
+}
+
+// checkUnique checks whether the item violates the unique constraints by looking up the indexes.
+// It must be called before updating the index so that the transaction isn't half-applied.
+func (b *BaseBucket) checkUnique(key []byte, jsonMap map[string]interface{}) error {
+	config, err := b.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	if len(config.Unique) == 0 {
+		return nil
+	}
+
+	if err := b.checkNotRebuilding(); err != nil {
+		return err
+	}
+
+	now := timeNow()
+	props := flattenProperties(jsonMap)
+	for _, n := range config.Unique {
+		values, ok := props[n]
+		if !ok {
+			continue
+		}
+
+		ic := b.IndexCursor(n)
+		for _, v := range values {
+			valueBytes, valueType := toIndexedBytes(config.indexValue(n, v))
+			if valueType == valueTypeNoIndex || valueType == ValueTypeNil {
+				continue
+			}
+
+			prefix := genIndexPrefixForSeekFirst(valueType, valueBytes)
+			for idx := ic.SeekFirst(valueType, valueBytes); idx != nil && bytes.HasPrefix(idx.key, prefix); idx = ic.Next() {
+				// the expired item is treated as absent.
+				if !bytes.Equal(idx.ref, key) && !b.isExpired(idx.ref, now) {
+					return &ErrUniqueViolation{Property: n, Value: v, Key: append([]byte{}, idx.ref...)}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkExistingUnique checks whether the existing items have duplicated values of the property.
+// The expired items are not checked in the same way as checkUnique.
+func (b *BaseBucket) checkExistingUnique(propName string) error {
+	config, err := b.IndexConfig()
+	if err != nil {
+		return err
+	}
+
+	found := map[string][]byte{}
+	now := timeNow()
+
+	return b.data.ForEach(func(key, value []byte) error {
+		// the expired item is treated as absent.
+		if b.isExpired(key, now) {
+			return nil
+		}
+
+		var jsonMap map[string]interface{}
+		if err := decodeJSON(value, &jsonMap); err != nil {
+			return nil
+		}
+
+		for _, v := range flattenProperties(jsonMap)[propName] {
+			valueBytes, valueType := toIndexedBytes(config.indexValue(propName, v))
+			if valueType == valueTypeNoIndex || valueType == ValueTypeNil {
+				continue
+			}
+
+			prefix := string(genIndexPrefixForSeekFirst(valueType, valueBytes))
+			if ref, ok := found[prefix]; ok && !bytes.Equal(ref, key) {
+				return &ErrUniqueViolation{Property: propName, Value: v, Key: ref}
+			}
+
+			found[prefix] = append([]byte{}, key...)
+		}
+
+		return nil
+	})
+}
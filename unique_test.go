@@ -0,0 +1,158 @@
+package bucketstore
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestUniqueIndex(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	bucket := db.Bucket("users")
+	bucket.PutRaw([]byte("user1"), []byte(`{"name": "joe", "email": "joe@example.com"}`))
+	bucket.PutRaw([]byte("user2"), []byte(`{"name": "joe", "email": "foo@example.com"}`))
+
+	// the existing items have duplicated names.
+	err = bucket.AddUniqueIndex("name")
+	if e, ok := err.(*ErrUniqueViolation); !ok || e.Property != "name" || e.Value != "joe" || string(e.Key) != "user1" {
+		t.Errorf("should raise ErrUniqueViolation: %v", err)
+	}
+
+	config, _ := bucket.IndexConfig()
+	if len(config.Unique) != 0 || len(config.Properties) != 0 {
+		t.Errorf("should not be changed: %v", config)
+	}
+
+	if err := bucket.AddUniqueIndex("email"); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	// updating the item itself doesn't violate.
+	if err := bucket.PutRaw([]byte("user1"), []byte(`{"name": "joe", "email": "joe@example.com", "age": 5}`)); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	err = bucket.PutRaw([]byte("user3"), []byte(`{"name": "coo", "email": "foo@example.com"}`))
+	if e, ok := err.(*ErrUniqueViolation); !ok || e.Property != "email" || e.Value != "foo@example.com" || string(e.Key) != "user2" {
+		t.Errorf("should raise ErrUniqueViolation: %v", err)
+	}
+
+	// the violating item is not applied.
+	if v, _ := bucket.GetRaw([]byte("user3")); v != nil {
+		t.Errorf("should be nil: %s", v)
+	}
+
+	q := bucket.Query()
+	q.Filter = &PropValueMatchFilter{Property: "name", Match: "coo"}
+	if count, _ := q.Count(); count != 0 {
+		t.Errorf("should be 0: %d", count)
+	}
+
+	// null values are not constrained.
+	bucket.PutRaw([]byte("user4"), []byte(`{"name": "tony", "email": null}`))
+	if err := bucket.PutRaw([]byte("user5"), []byte(`{"name": "leo", "email": null}`)); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	// in a transaction, the violating put doesn't break the transaction.
+	err = db.Update(func(tx *Tx) error {
+		b, err := tx.Bucket("users")
+		if err != nil {
+			return err
+		}
+
+		if err := b.PutRaw([]byte("user6"), []byte(`{"email": "joe@example.com"}`)); err == nil {
+			t.Errorf("should raise error")
+		}
+
+		return b.PutRaw([]byte("user6"), []byte(`{"email": "bob@example.com"}`))
+	})
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	// dropping the index removes the constraint.
+	if err := bucket.DropIndex("email"); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if err := bucket.PutRaw([]byte("user3"), []byte(`{"name": "coo", "email": "foo@example.com"}`)); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+}
+
+func TestUniqueIndexWithExpiredItems(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	bucket := db.Bucket("users")
+	bucket.PutWithTTL([]byte("user1"), []byte(`{"email": "joe@example.com"}`), time.Minute)
+	bucket.PutRaw([]byte("user2"), []byte(`{"email": "joe@example.com"}`))
+
+	if err := bucket.AddUniqueIndex("email"); err == nil {
+		t.Errorf("should raise error")
+	}
+
+	// the expired item doesn't violate the constraint.
+	now = now.Add(time.Hour)
+	if err := bucket.AddUniqueIndex("email"); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if err := bucket.PutRaw([]byte("user3"), []byte(`{"email": "joe@example.com"}`)); err == nil {
+		t.Errorf("should raise error")
+	}
+	// the violating put doesn't delete the expired item in the transaction even if it is committed.
+	err = db.Update(func(tx *Tx) error {
+		b, err := tx.Bucket("users")
+		if err != nil {
+			return err
+		}
+
+		if err := b.PutRaw([]byte("user1"), []byte(`{"email": "joe@example.com"}`)); err == nil {
+			t.Errorf("should raise error")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	err = db.View(func(tx *Tx) error {
+		if tx.bData().Bucket([]byte("users")).Get([]byte("user1")) == nil {
+			t.Errorf("should not be deleted")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+}
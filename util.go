@@ -3,7 +3,9 @@ package bucketstore
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"io"
 	"math"
 )
 
@@ -22,6 +24,50 @@ func BytesToFloat64(b []byte) float64 {
 	return math.Float64frombits(bits)
 }
 
+// Float64ToIndexBytes converts a float64 to the order-preserving bytes
+// that are used as a value of the index key.
+// The sign bit is flipped for positive numbers and all bits are flipped
+// for negative numbers, so that the bytes sort the same as the numbers.
+func Float64ToIndexBytes(v float64) []byte {
+	if v == 0 {
+		// normalize -0 to 0.
+		v = 0
+	}
+
+	bits := math.Float64bits(v)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+
+	return Uint64ToBytes(bits)
+}
+
+// IndexBytesToFloat64 converts bytes generated by Float64ToIndexBytes to a float64.
+func IndexBytesToFloat64(b []byte) float64 {
+	bits := binary.BigEndian.Uint64(b)
+	if bits&(1<<63) != 0 {
+		bits &^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+
+	return math.Float64frombits(bits)
+}
+
+// Int64ToIndexBytes converts an int64 to the order-preserving bytes
+// that are used as a value of the index key.
+// The sign bit is flipped, so that the bytes sort the same as the numbers.
+func Int64ToIndexBytes(v int64) []byte {
+	return Uint64ToBytes(uint64(v) ^ (1 << 63))
+}
+
+// IndexBytesToInt64 converts bytes generated by Int64ToIndexBytes to an int64.
+func IndexBytesToInt64(b []byte) int64 {
+	return int64(binary.BigEndian.Uint64(b) ^ (1 << 63))
+}
+
 func StringToBytes(v string) []byte {
 	return []byte(v)
 }
@@ -31,6 +77,7 @@ const (
 	ValueTypeString  = 0x02
 	ValueTypeFloat64 = 0x03
 	ValueTypeNil     = 0x04
+	ValueTypeInt64   = 0x05
 	valueTypeNoIndex = 0x00
 )
 
@@ -54,7 +101,16 @@ const (
 //  0x02 0x61 0x62 0x63 0x00 0xFF <key>
 //
 // Example: 1
-//  0x03 0x00 0x00 0x00 0x00 0x00 0x00 0x00 0x01 0x00 0xFF <key>
+//  0x03 0xBF 0xF0 0x00 0x00 0x00 0x00 0x00 0x00 0x00 0xFF <key>
+//
+// A number is stored as order-preserving bytes generated by Float64ToIndexBytes.
+// So negative numbers sort before positive numbers.
+//
+// Example: 1 of an integer property
+//  0x05 0x80 0x00 0x00 0x00 0x00 0x00 0x00 0x01 0x00 0xFF <key>
+//
+// An integer of the property declared by AddIntegerIndex is stored as order-preserving bytes
+// generated by Int64ToIndexBytes, so that 64-bit integers are indexed exactly.
 //
 // ## Description
 //
@@ -162,7 +218,7 @@ func getValueFromIndexKey(indexKey []byte) ([]byte, error) {
 			return nil, fmt.Errorf("got a illegal formatted key %v", indexKey)
 		}
 		return indexKey[1:i+1], nil
-	case ValueTypeFloat64:
+	case ValueTypeFloat64, ValueTypeInt64:
 		return indexKey[1:9], nil
 	case ValueTypeNil:
 		return nil, nil
@@ -186,27 +242,23 @@ func toIndexedBytes(value interface{}) ([]byte, byte) {
 		return []byte(converted), ValueTypeString
 	case float64:
 		// JSON number
-		// http://stackoverflow.com/questions/22491876/convert-byte-array-uint8-to-float64-in-golang
-		bits := math.Float64bits(converted)
-		bytes := make([]byte, 8)
-		binary.BigEndian.PutUint64(bytes, bits)
-		return bytes, ValueTypeFloat64
+		return Float64ToIndexBytes(converted), ValueTypeFloat64
 	case int:
 		// JSON number
-		c := float64(converted)
-
-		bits := math.Float64bits(c)
-		bytes := make([]byte, 8)
-		binary.BigEndian.PutUint64(bytes, bits)
-		return bytes, ValueTypeFloat64
+		return Float64ToIndexBytes(float64(converted)), ValueTypeFloat64
 	case int64:
 		// JSON number
-		c := float64(converted)
-
-		bits := math.Float64bits(c)
-		bytes := make([]byte, 8)
-		binary.BigEndian.PutUint64(bytes, bits)
-		return bytes, ValueTypeFloat64
+		return Float64ToIndexBytes(float64(converted)), ValueTypeFloat64
+	case json.Number:
+		// JSON number decoded by decodeJSON
+		f, err := converted.Float64()
+		if err != nil {
+			return nil, valueTypeNoIndex
+		}
+		return Float64ToIndexBytes(f), ValueTypeFloat64
+	case indexInt:
+		// JSON number of an integer property
+		return Int64ToIndexBytes(int64(converted)), ValueTypeInt64
 	case nil:
 		// JSON null
 		return nil, ValueTypeNil
@@ -222,3 +274,20 @@ func toIndexedBytes(value interface{}) ([]byte, byte) {
 		return nil, valueTypeNoIndex
 	}
 }
+
+// decodeJSON decodes the JSON bytes like json.Unmarshal,
+// but it decodes numbers to json.Number to keep their precision.
+func decodeJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+
+	// the data must be a single JSON value like json.Unmarshal.
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("invalid character after top-level value")
+	}
+
+	return nil
+}
@@ -3,6 +3,7 @@ package bucketstore
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"testing"
 )
 
@@ -88,7 +89,7 @@ func TestGetValueFromIndexKey(t *testing.T) {
 	if err != nil {
 		t.Errorf("should not raise error")
 	}
-	if int(BytesToFloat64(bb)) != 123 {
+	if int(IndexBytesToFloat64(bb)) != 123 {
 		t.Errorf("invalid value : %s %v", string(bb), bb)
 	}
 }
@@ -108,4 +109,25 @@ func TestToIndexedBytes(t *testing.T) {
 	if b != ValueTypeFloat64 {
 		t.Errorf("invalid type : %v", b)
 	}
-}
\ No newline at end of file
+}
+func TestFloat64ToIndexBytes(t *testing.T) {
+	values := []float64{math.Inf(-1), -math.MaxFloat64, -1000, -10.5, -1, -math.SmallestNonzeroFloat64, 0, math.SmallestNonzeroFloat64, 1, 10.5, 1000, math.MaxFloat64, math.Inf(1)}
+
+	for i := 1; i < len(values); i++ {
+		prev := Float64ToIndexBytes(values[i-1])
+		b := Float64ToIndexBytes(values[i])
+		if bytes.Compare(prev, b) >= 0 {
+			t.Errorf("invalid order: %v(%v) >= %v(%v)", values[i-1], prev, values[i], b)
+		}
+	}
+
+	for _, v := range values {
+		if IndexBytesToFloat64(Float64ToIndexBytes(v)) != v {
+			t.Errorf("invalid value : %v", v)
+		}
+	}
+
+	if bytes.Compare(Float64ToIndexBytes(math.Copysign(0, -1)), Float64ToIndexBytes(0)) != 0 {
+		t.Errorf("-0 should be the same as 0")
+	}
+}
@@ -0,0 +1,155 @@
+package bucketstore
+
+import (
+	"fmt"
+)
+
+// ValueMode is a mode to decide what kind of values a bucket accepts.
+type ValueMode string
+
+const (
+	// ValueModeJSONObject accepts only JSON objects and indexes their properties. It is the default mode.
+	ValueModeJSONObject ValueMode = "json-object"
+	// ValueModeJSONAny accepts any JSON values like arrays and scalars, but doesn't index them.
+	ValueModeJSONAny ValueMode = "json-any"
+	// ValueModeRaw accepts arbitrary bytes and doesn't index them.
+	ValueModeRaw ValueMode = "raw"
+)
+
+// ValueMode gets the value mode of the bucket.
+func (b *BaseBucket) ValueMode() ValueMode {
+	if b.valueMode != "" {
+		return b.valueMode
+	}
+
+	mode := ValueModeJSONObject
+
+	// the database opened in the read only mode may not have the value modes bucket.
+	if bucket := b.tx.bValueModes(); bucket != nil {
+		if v := bucket.Get(b.name); v != nil {
+			mode = ValueMode(v)
+		}
+	}
+
+	b.valueMode = mode
+	return mode
+}
+
+// SetValueMode changes the value mode of the bucket.
+// The existing items must be acceptable in the new mode.
+// Changing to the json-object mode returns ErrUniqueViolation if the existing items violate the unique constraints.
+// Changing from the json-object mode drops the indexes,
+// and changing to the json-object mode creates the indexes of the existing items.
+func (b *BaseBucket) SetValueMode(mode ValueMode) error {
+	switch mode {
+	case ValueModeJSONObject, ValueModeJSONAny, ValueModeRaw:
+	default:
+		return fmt.Errorf("unsupported value mode: %s", mode)
+	}
+
+	current := b.ValueMode()
+	if current == mode {
+		return nil
+	}
+
+	if mode == ValueModeRaw && b.Schema() != nil {
+		return fmt.Errorf("the bucket that has a schema can't be changed to the raw mode. drop the schema at first.")
+	}
+
+	// check the existing items before changing anything.
+	err := b.data.ForEach(func(key, value []byte) error {
+		switch mode {
+		case ValueModeJSONObject:
+			var jsonMap map[string]interface{}
+			if err := decodeJSON(value, &jsonMap); err != nil {
+				return fmt.Errorf("the item %q is not a json object: %v", string(key), err)
+			}
+		case ValueModeJSONAny:
+			var v interface{}
+			if err := decodeJSON(value, &v); err != nil {
+				return fmt.Errorf("the item %q is not a json: %v", string(key), err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if mode == ValueModeJSONObject {
+		config, err := b.IndexConfig()
+		if err != nil {
+			return err
+		}
+
+		// the unique constraints are not checked in the other modes.
+		for _, n := range config.Unique {
+			if err := b.checkExistingUnique(n); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := b.tx.bValueModes().Put(b.name, []byte(mode)); err != nil {
+		return err
+	}
+	b.valueMode = mode
+
+	if current == ValueModeJSONObject {
+		return b.deleteAllIndexBuckets()
+	}
+
+	if mode == ValueModeJSONObject {
+		if err := b.createCompoundIndexBuckets(); err != nil {
+			return err
+		}
+
+		return b.data.ForEach(func(key, value []byte) error {
+			var jsonMap map[string]interface{}
+			if err := decodeJSON(value, &jsonMap); err != nil {
+				return err
+			}
+
+			if err := b.putIndex(key, jsonMap, nil); err != nil {
+				return err
+			}
+
+			if err := b.refreshCompoundIndex(key, nil, jsonMap); err != nil {
+				return err
+			}
+
+			return b.refreshTextIndex(key, nil, jsonMap)
+		})
+	}
+
+	return nil
+}
+
+// isIndexable reports whether the items of the bucket are indexed.
+// The index configuration is kept in the other modes, and is applied when the bucket is changed to the json-object mode.
+func (b *BaseBucket) isIndexable() bool {
+	return b.ValueMode() == ValueModeJSONObject
+}
+
+func (b *BaseBucket) deleteAllIndexBuckets() error {
+	// collect the names at first because the bucket must not be modified while iterating.
+	names := [][]byte{}
+	err := b.index.ForEach(func(k, v []byte) error {
+		if v == nil {
+			names = append(names, append([]byte{}, k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, n := range names {
+		if err := b.index.DeleteBucket(n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package bucketstore
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestBucketValueMode(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	db, err := Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer db.Close()
+
+	bucket := db.Bucket("zoo")
+	mode, err := bucket.ValueMode()
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if mode != ValueModeJSONObject {
+		t.Errorf("unmatch: %s", mode)
+	}
+
+	if err := bucket.PutRaw([]byte("key1"), []byte(`[1, 2]`)); err == nil {
+		t.Errorf("should raise error")
+	}
+
+	bucket.PutRaw([]byte("key1"), []byte(`{"name": "joe"}`))
+	assertIndexProperties(t, bucket, []string{"name"})
+
+	if err := bucket.SetValueMode("unknown"); err == nil {
+		t.Errorf("should raise error")
+	}
+
+	// json-any
+	if err := bucket.SetValueMode(ValueModeJSONAny); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	assertIndexProperties(t, bucket, nil)
+
+	if err := bucket.PutRaw([]byte("key2"), []byte(`[1, 2]`)); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if err := bucket.PutRaw([]byte("key3"), []byte(`"foo"`)); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if err := bucket.PutRaw([]byte("key4"), []byte(`{"name": "bar"}`)); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if err := bucket.PutRaw([]byte("key5"), []byte(`not json`)); err == nil {
+		t.Errorf("should raise error")
+	}
+	assertIndexProperties(t, bucket, nil)
+
+	if v, _ := bucket.GetRaw([]byte("key2")); string(v) != `[1,2]` {
+		t.Errorf("unmatch: %s", v)
+	}
+
+	// the items aren't json objects.
+	if err := bucket.SetValueMode(ValueModeJSONObject); err == nil {
+		t.Errorf("should raise error")
+	}
+
+	// the bucket that has a schema can't be changed to raw.
+	if err := bucket.SetSchema([]byte(`{"type": ["array", "string", "object"]}`)); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if err := bucket.SetValueMode(ValueModeRaw); err == nil {
+		t.Errorf("should raise error")
+	}
+	if err := bucket.DropSchema(); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	// raw
+	if err := bucket.SetValueMode(ValueModeRaw); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	if err := bucket.PutRaw([]byte("key5"), []byte{0x00, 0xff}); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if v, _ := bucket.GetRaw([]byte("key5")); string(v) != "\x00\xff" {
+		t.Errorf("unmatch: %v", v)
+	}
+	if err := bucket.SetSchema([]byte(`{"type": "object"}`)); err == nil {
+		t.Errorf("should raise error")
+	}
+
+	// the item isn't a json.
+	if err := bucket.SetValueMode(ValueModeJSONAny); err == nil {
+		t.Errorf("should raise error")
+	}
+
+	for _, k := range []string{"key2", "key3", "key5"} {
+		if err := bucket.Delete([]byte(k)); err != nil {
+			t.Errorf("should not raise error: %v", err)
+		}
+	}
+
+	// the compound index is declared in the raw mode.
+	if err := bucket.AddCompoundIndex("name", "age"); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	// changing to json-object creates the index of the existing items.
+	if err := bucket.SetValueMode(ValueModeJSONObject); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	assertIndexProperties(t, bucket, []string{"name"})
+
+	q := bucket.Query()
+	q.Filter = &PropValueMatchFilter{Property: "name", Match: "bar"}
+	if count, _ := q.Count(); count != 1 {
+		t.Errorf("should be 1: %d", count)
+	}
+
+	bucket.PutRaw([]byte("key6"), []byte(`{"name": "bar", "age": 3}`))
+	q = bucket.Query()
+	q.Filter = &CompoundIndexFilter{Properties: []string{"name", "age"}, Match: []interface{}{"bar"}}
+	if count, _ := q.Count(); count != 1 {
+		t.Errorf("should be 1: %d", count)
+	}
+
+	// the unique constraints are checked when the bucket is changed to json-object.
+	if err := bucket.SetValueMode(ValueModeJSONAny); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if err := bucket.AddUniqueIndex("email"); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	bucket.PutRaw([]byte("key7"), []byte(`{"email": "joe@example.com"}`))
+	bucket.PutRaw([]byte("key8"), []byte(`{"email": "joe@example.com"}`))
+
+	err = bucket.SetValueMode(ValueModeJSONObject)
+	if e, ok := err.(*ErrUniqueViolation); !ok || e.Property != "email" || string(e.Key) != "key7" {
+		t.Errorf("should raise ErrUniqueViolation: %v", err)
+	}
+	if mode, _ := bucket.ValueMode(); mode != ValueModeJSONAny {
+		t.Errorf("unmatch: %s", mode)
+	}
+
+	bucket.Delete([]byte("key8"))
+	if err := bucket.SetValueMode(ValueModeJSONObject); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	// deleting the bucket resets the mode.
+	bucket.SetValueMode(ValueModeRaw)
+	err = db.Update(func(tx *Tx) error {
+		return tx.DeleteBucket("zoo")
+	})
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+
+	if mode, _ := bucket.ValueMode(); mode != ValueModeJSONObject {
+		t.Errorf("unmatch: %s", mode)
+	}
+}